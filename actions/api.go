@@ -0,0 +1,486 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+)
+
+// apiAuthor is the public view of a models.User exposed by the JSON API.
+type apiAuthor struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	FullName string    `json:"full_name"`
+}
+
+func newAPIAuthor(usr *models.User) *apiAuthor {
+	if usr == nil {
+		return nil
+	}
+	return &apiAuthor{
+		ID:       usr.ID,
+		Username: usr.Username,
+		FullName: usr.FullName,
+	}
+}
+
+type apiTopic struct {
+	models.Topic
+	Author  *apiAuthor `json:"author"`
+	Replies int        `json:"replies"`
+}
+
+type apiReply struct {
+	models.Reply
+	Author *apiAuthor `json:"author"`
+}
+
+// apiPost holds the fields a client may set when creating or
+// editing a topic or a reply.
+type apiPost struct {
+	Title   string   `json:"title" form:"Title"`
+	Content string   `json:"content" form:"Content"`
+	Reason  string   `json:"reason,omitempty" form:"Reason"` // edit reason, for updates
+	Tags    []string `json:"tags,omitempty" form:"Tags"`
+
+	// ParentReplyID is the reply a new reply answers, if any.
+	ParentReplyID string `json:"parent_reply_id,omitempty" form:"ParentReplyID"`
+}
+
+// apiError renders a JSON error message with the given status code.
+func apiError(c buffalo.Context, status int, msg string) error {
+	return c.Render(status, r.JSON(map[string]interface{}{
+		"error": msg,
+	}))
+}
+
+// apiValidationError renders validation errors as a JSON object.
+func apiValidationError(c buffalo.Context, verrs *validate.Errors) error {
+	return c.Render(422, r.JSON(map[string]interface{}{
+		"error":  "validation failed",
+		"errors": verrs.Errors,
+	}))
+}
+
+// apiFind loads the model with the given id, reporting 404 when it does not exist.
+func apiFind(c buffalo.Context, model interface{}, id string) (bool, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	if err := tx.Find(model, id); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	return true, nil
+}
+
+// APIUserRequired requires a user to be logged in before accessing an API route.
+func APIUserRequired(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		user, ok := c.Value("current_user").(*models.User)
+		if ok && user != nil {
+			return next(c)
+		}
+		return apiError(c, 401, "authentication required")
+	}
+}
+
+// APICategoriesIndex lists all categories.
+func APICategoriesIndex(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cats := &models.Categories{}
+	// sorted as models.Categories, before paginating.
+	q := tx.PaginateFromParams(c.Params()).Order("position, title, id")
+	if err := q.All(cats); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(200, r.JSON(map[string]interface{}{
+		"categories": cats,
+		"pagination": q.Paginator,
+	}))
+}
+
+// APICategoriesDetail displays a category and its topics.
+func APICategoriesDetail(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cat := &models.Category{}
+	ok, err := apiFind(c, cat, c.Param("cid"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apiError(c, 404, "category not found")
+	}
+
+	topics := &models.Topics{}
+	// pinned topics come first.
+	order := "CASE pinned WHEN 'global' THEN 0 WHEN 'category' THEN 1 ELSE 2 END, "
+	if c.Param("sort") == "reactions" {
+		order += "reactions desc, "
+	}
+	order += "created_at desc"
+	q := tx.PaginateFromParams(c.Params()).BelongsTo(cat).Where("deleted = ?", false)
+	if c.Param("filter") == "unsolved" {
+		q = q.Where("solution_id IS NULL")
+	}
+	if tag := c.Param("tag"); tag != "" {
+		q = q.Where("? = ANY(tags)", models.NormalizeTag(tag))
+	}
+	if usr := c.Value("current_user").(*models.User); !usr.Moderates(cat) {
+		q = q.Where("unlisted = ?", false)
+	}
+	if err := q.Order(order).All(topics); err != nil {
+		return errors.WithStack(err)
+	}
+	// authors and reply counts are loaded for the whole page at once.
+	tids := make([]uuid.UUID, 0, len(*topics))
+	uids := make([]uuid.UUID, 0, len(*topics))
+	for _, t := range *topics {
+		tids = append(tids, t.ID)
+		uids = append(uids, t.AuthorID)
+	}
+	authors, err := findUsers(tx, uids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	counts, err := countPosts(tx, tids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	out := make([]apiTopic, 0, len(*topics))
+	for _, t := range *topics {
+		out = append(out, apiTopic{
+			Topic:   t,
+			Author:  newAPIAuthor(authors[t.AuthorID]),
+			Replies: counts[t.ID],
+		})
+	}
+	return c.Render(200, r.JSON(map[string]interface{}{
+		"category":   cat,
+		"topics":     out,
+		"pagination": q.Paginator,
+	}))
+}
+
+// APITopicsDetail displays a topic and its replies.
+func APITopicsDetail(c buffalo.Context) error {
+	ok, err := apiFind(c, &models.Topic{}, c.Param("tid"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apiError(c, 404, "topic not found")
+	}
+	topic, err := loadTopic(c, c.Param("tid"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if topic.MergedInto.Valid {
+		return c.Redirect(301, "/api/v1/topics/%s", topic.MergedInto.UUID)
+	}
+	if topic.Deleted {
+		return apiError(c, 404, "topic not found")
+	}
+
+	replies := make([]apiReply, 0, len(topic.Replies))
+	for _, reply := range topic.Replies {
+		replies = append(replies, apiReply{
+			Reply:  reply,
+			Author: newAPIAuthor(reply.Author),
+		})
+	}
+	return c.Render(200, r.JSON(map[string]interface{}{
+		"topic": apiTopic{
+			Topic:   *topic,
+			Author:  newAPIAuthor(topic.Author),
+			Replies: len(topic.Replies.Posts()),
+		},
+		"replies": replies,
+	}))
+}
+
+// APITopicsCreate creates a new topic in a category.
+func APITopicsCreate(c buffalo.Context) error {
+	cat := new(models.Category)
+	ok, err := apiFind(c, cat, c.Param("cid"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apiError(c, 404, "category not found")
+	}
+	if cat.Archived {
+		return apiError(c, 403, "category is archived")
+	}
+
+	post := new(apiPost)
+	if err := c.Bind(post); err != nil {
+		return apiError(c, 400, "invalid request body")
+	}
+
+	topic := &models.Topic{
+		Title:      post.Title,
+		Content:    post.Content,
+		Category:   cat,
+		CategoryID: cat.ID,
+		Tags:       models.ParseTags(strings.Join(post.Tags, ",")),
+	}
+	verrs, err := createTopic(c, topic, nil, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return apiValidationError(c, verrs)
+	}
+
+	return c.Render(201, r.JSON(apiTopic{
+		Topic:  *topic,
+		Author: newAPIAuthor(topic.Author),
+	}))
+}
+
+// APITopicsUpdate edits the title and content of a topic.
+func APITopicsUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	topic := new(models.Topic)
+	ok, err := apiFind(c, topic, c.Param("tid"))
+	if err != nil {
+		return err
+	}
+	if !ok || topic.Deleted {
+		return apiError(c, 404, "topic not found")
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if !usr.CanEditIn(topic.AuthorID, topic, cat) {
+		return apiError(c, 403, "not authorized to edit this topic")
+	}
+	if cat.Archived {
+		return refuseArchived(c, topic.ID)
+	}
+
+	post := &apiPost{Title: topic.Title, Content: topic.Content, Tags: topic.Tags}
+	if err := c.Bind(post); err != nil {
+		return apiError(c, 400, "invalid request body")
+	}
+	orig := topic.Revision(topic.AuthorID, "")
+	orig.CreatedAt = topic.CreatedAt
+	topic.Title = post.Title
+	topic.Content = post.Content
+	topic.Tags = models.ParseTags(strings.Join(post.Tags, ","))
+	if verrs := c.Value("forum").(*models.Forum).CheckTags(topic.Tags); verrs.HasAny() {
+		return apiValidationError(c, verrs)
+	}
+
+	verrs, err := topic.Validate(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return apiValidationError(c, verrs)
+	}
+	if err := saveEdit(tx, topic, orig, topic.Revision(usr.ID, post.Reason)); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := mentionNotify(c, topic, uuid.Nil, usr, topic.Content, orig.Content, nil); err != nil {
+		return errors.WithStack(err)
+	}
+	topic, err = loadTopic(c, topic.ID.String())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(200, r.JSON(apiTopic{
+		Topic:   *topic,
+		Author:  newAPIAuthor(topic.Author),
+		Replies: len(topic.Replies.Posts()),
+	}))
+}
+
+// APITopicsDelete marks a topic as deleted.
+func APITopicsDelete(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	topic := new(models.Topic)
+	ok, err := apiFind(c, topic, c.Param("tid"))
+	if err != nil {
+		return err
+	}
+	if !ok || topic.Deleted {
+		return apiError(c, 404, "topic not found")
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if !usr.CanDelete(topic.AuthorID, cat) {
+		return apiError(c, 403, "not authorized to delete this topic")
+	}
+	if cat.Archived {
+		return refuseArchived(c, topic.ID)
+	}
+	topic.Deleted = true
+	if err := tx.Update(topic); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(204, nil)
+}
+
+// APIRepliesCreate adds a reply to a topic.
+func APIRepliesCreate(c buffalo.Context) error {
+	ok, err := apiFind(c, &models.Topic{}, c.Param("tid"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apiError(c, 404, "topic not found")
+	}
+	post := new(apiPost)
+	if err := c.Bind(post); err != nil {
+		return apiError(c, 400, "invalid request body")
+	}
+
+	topic, err := loadTopic(c, c.Param("tid"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if topic.Deleted {
+		return apiError(c, 404, "topic not found")
+	}
+	if topic.Locked {
+		return apiError(c, 403, "topic is locked")
+	}
+	if topic.Closed {
+		return apiError(c, 403, "topic is closed")
+	}
+	if topic.Category.Archived {
+		return apiError(c, 403, "category is archived")
+	}
+
+	var parent *models.Reply
+	if post.ParentReplyID != "" {
+		parent = new(models.Reply)
+		ok, err := apiFind(c, parent, post.ParentReplyID)
+		if err != nil {
+			return err
+		}
+		if !ok || parent.TopicID != topic.ID || parent.Deleted {
+			return apiError(c, 404, "parent reply not found")
+		}
+	}
+	reply := &models.Reply{Content: post.Content}
+	verrs, err := createReply(c, topic, reply, parent, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return apiValidationError(c, verrs)
+	}
+
+	return c.Render(201, r.JSON(apiReply{
+		Reply:  *reply,
+		Author: newAPIAuthor(reply.Author),
+	}))
+}
+
+// APIRepliesUpdate edits the content of a reply.
+func APIRepliesUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reply := new(models.Reply)
+	ok, err := apiFind(c, reply, c.Param("rid"))
+	if err != nil {
+		return err
+	}
+	if !ok || reply.Deleted {
+		return apiError(c, 404, "reply not found")
+	}
+	cat, err := replyCategory(tx, reply)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if reply.Event != "" || !usr.CanEditIn(reply.AuthorID, reply.Topic, cat) {
+		return apiError(c, 403, "not authorized to edit this reply")
+	}
+	if cat.Archived {
+		return refuseArchived(c, reply.TopicID)
+	}
+
+	post := &apiPost{Content: reply.Content}
+	if err := c.Bind(post); err != nil {
+		return apiError(c, 400, "invalid request body")
+	}
+	orig := reply.Revision(reply.AuthorID, "")
+	orig.CreatedAt = reply.CreatedAt
+	reply.Content = post.Content
+
+	verrs, err := reply.Validate(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return apiValidationError(c, verrs)
+	}
+	if err := saveEdit(tx, reply, orig, reply.Revision(usr.ID, post.Reason)); err != nil {
+		return errors.WithStack(err)
+	}
+	topic := new(models.Topic)
+	if err := tx.Find(topic, reply.TopicID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := mentionNotify(c, topic, reply.ID, usr, reply.Content, orig.Content, nil); err != nil {
+		return errors.WithStack(err)
+	}
+	reply, err = loadReply(c, reply.ID.String())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(200, r.JSON(apiReply{
+		Reply:  *reply,
+		Author: newAPIAuthor(reply.Author),
+	}))
+}
+
+// APIRepliesDelete marks a reply as deleted.
+func APIRepliesDelete(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reply := new(models.Reply)
+	ok, err := apiFind(c, reply, c.Param("rid"))
+	if err != nil {
+		return err
+	}
+	if !ok || reply.Deleted {
+		return apiError(c, 404, "reply not found")
+	}
+	cat, err := replyCategory(tx, reply)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if !usr.CanDelete(reply.AuthorID, cat) {
+		return apiError(c, 403, "not authorized to delete this reply")
+	}
+	if cat.Archived {
+		return refuseArchived(c, reply.TopicID)
+	}
+	reply.Deleted = true
+	if err := tx.Update(reply); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := models.ClearSolution(tx, reply.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(204, nil)
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"encoding/json"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/nulls"
+)
+
+// apiToken creates a user and returns the user and an access token of
+// the given scope.
+func (as *ActionSuite) apiToken(scope string) (*models.User, string) {
+	usr := &models.User{
+		Username:        "usr1",
+		Email:           "user@example.com",
+		Password:        "password",
+		PasswordConfirm: "password",
+	}
+	verrs, err := usr.Create(as.DB)
+	as.NoError(err)
+	as.False(verrs.HasAny())
+	tok, verrs, err := (&models.AccessToken{Name: "bot", Scope: scope}).Create(as.DB, usr)
+	as.NoError(err)
+	as.False(verrs.HasAny())
+	return usr, tok
+}
+
+func (as *ActionSuite) Test_API_AuthenticationRequired() {
+	res := as.JSON("/api/v1/categories").Get()
+	as.Equal(401, res.Code)
+}
+
+func (as *ActionSuite) Test_API_CategoriesIndex() {
+	_, tok := as.apiToken(models.ScopeRead)
+	for i, title := range []string{"c", "a", "b"} {
+		as.NoError(as.DB.Create(&models.Category{Title: title, Position: i % 2}))
+	}
+
+	// categories are sorted across pages.
+	var titles []string
+	for _, page := range []string{"1", "2", "3"} {
+		req := as.JSON("/api/v1/categories?per_page=1&page=" + page)
+		req.Headers["Authorization"] = "Bearer " + tok
+		res := req.Get()
+		as.Equal(200, res.Code)
+		var out struct {
+			Categories []models.Category `json:"categories"`
+		}
+		as.NoError(json.Unmarshal(res.Body.Bytes(), &out))
+		as.Len(out.Categories, 1)
+		titles = append(titles, out.Categories[0].Title)
+	}
+	as.Equal([]string{"b", "c", "a"}, titles)
+}
+
+func (as *ActionSuite) Test_API_CategoriesDetail() {
+	usr, tok := as.apiToken(models.ScopeRead)
+	cat := &models.Category{Title: "cat"}
+	as.NoError(as.DB.Create(cat))
+	topic := &models.Topic{Title: "topic", Content: "content", CategoryID: cat.ID, AuthorID: usr.ID}
+	as.NoError(as.DB.Create(topic))
+	as.NoError(as.DB.Create(&models.Reply{TopicID: topic.ID, AuthorID: usr.ID, Content: "reply"}))
+	as.NoError(as.DB.Create(&models.Reply{TopicID: topic.ID, AuthorID: usr.ID, Content: "deleted", Deleted: true}))
+	as.NoError(models.AddEvent(as.DB, topic.ID, usr.ID, models.EventLocked))
+
+	req := as.JSON("/api/v1/categories/" + cat.ID.String())
+	req.Headers["Authorization"] = "Bearer " + tok
+	res := req.Get()
+	as.Equal(200, res.Code)
+	var out struct {
+		Topics []struct {
+			Title  string `json:"title"`
+			Author struct {
+				Username string `json:"username"`
+			} `json:"author"`
+			Replies int `json:"replies"`
+		} `json:"topics"`
+	}
+	as.NoError(json.Unmarshal(res.Body.Bytes(), &out))
+	as.Len(out.Topics, 1)
+	as.Equal("topic", out.Topics[0].Title)
+	as.Equal("usr1", out.Topics[0].Author.Username)
+	as.Equal(1, out.Topics[0].Replies)
+}
+
+func (as *ActionSuite) Test_API_ArchivedReadOnly() {
+	usr, tok := as.apiToken(models.ScopeWrite)
+	cat := &models.Category{Title: "cat", Archived: true}
+	as.NoError(as.DB.Create(cat))
+	topic := &models.Topic{Title: "topic", Content: "content", CategoryID: cat.ID, AuthorID: usr.ID}
+	as.NoError(as.DB.Create(topic))
+
+	req := as.JSON("/api/v1/topics/" + topic.ID.String())
+	req.Headers["Authorization"] = "Bearer " + tok
+	res := req.Put(map[string]string{"title": "edited", "content": "edited"})
+	as.Equal(403, res.Code)
+	res = req.Delete()
+	as.Equal(403, res.Code)
+
+	as.NoError(as.DB.Reload(topic))
+	as.Equal("topic", topic.Title)
+	as.False(topic.Deleted)
+}
+
+func (as *ActionSuite) Test_API_RepliesCreate() {
+	usr, tok := as.apiToken(models.ScopeWrite)
+	cat := &models.Category{Title: "cat"}
+	as.NoError(as.DB.Create(cat))
+	topic := &models.Topic{Title: "topic", Content: "content", CategoryID: cat.ID, AuthorID: usr.ID}
+	as.NoError(as.DB.Create(topic))
+	parent := &models.Reply{TopicID: topic.ID, AuthorID: usr.ID, Content: "parent"}
+	as.NoError(as.DB.Create(parent))
+	draft := &models.Draft{UserID: usr.ID, Context: models.ReplyDraftContext(topic.ID), TopicID: nulls.NewUUID(topic.ID), Content: "draft"}
+	as.NoError(models.SaveDraft(as.DB, draft))
+
+	req := as.JSON("/api/v1/topics/" + topic.ID.String() + "/replies")
+	req.Headers["Authorization"] = "Bearer " + tok
+	res := req.Post(map[string]string{"content": "answer", "parent_reply_id": parent.ID.String()})
+	as.Equal(201, res.Code)
+
+	// API replies are threaded and clear the draft, as web replies do.
+	reply := new(models.Reply)
+	as.NoError(as.DB.Where("content = ?", "answer").First(reply))
+	as.True(reply.ParentReplyID.Valid)
+	as.Equal(parent.ID, reply.ParentReplyID.UUID)
+	n, err := as.DB.Where("user_id = ?", usr.ID).Count(&models.Draft{})
+	as.NoError(err)
+	as.Equal(0, n)
+
+	res = req.Post(map[string]string{"content": "answer", "parent_reply_id": topic.ID.String()})
+	as.Equal(404, res.Code)
+}
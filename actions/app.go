@@ -12,7 +12,6 @@ import (
 	"github.com/unrolled/secure"
 
 	"github.com/go-saloon/saloon/models"
-	"github.com/gobuffalo/buffalo/middleware/csrf"
 	"github.com/gobuffalo/buffalo/middleware/i18n"
 	"github.com/gobuffalo/packr"
 )
@@ -43,9 +42,16 @@ func App() *buffalo.App {
 			app.Use(middleware.ParameterLogger)
 		}
 
+		// Limits the size of request bodies, before the CSRF middleware reads them.
+		app.Use(LimitRequestBody)
+
 		// Protect against CSRF attacks. https://www.owasp.org/index.php/Cross-Site_Request_Forgery_(CSRF)
+		// Requests authenticated with a personal access token are exempted.
 		// Remove to disable this.
-		app.Use(csrf.New)
+		app.Use(CSRFUnlessToken)
+
+		// Keeps the attachment store in step with the transaction below.
+		app.Use(TrackAttachmentFiles)
 
 		// Wraps each request in a transaction.
 		//  c.Value("tx").(*pop.PopTransaction)
@@ -63,17 +69,36 @@ func App() *buffalo.App {
 		}
 		app.Use(T.Middleware())
 
+		registerLoginProviders()
+		if err := setupStorage(); err != nil {
+			app.Stop(err)
+		}
+
 		app.GET("/", HomeHandler)
 
 		app.ServeFiles("/assets", assetsBox)
 
+		manageUsers := PermissionRequired(models.PermManageUsers)
+		createCategory := PermissionRequired(models.PermCreateCategory)
+
 		auth := app.Group("/users")
 		auth.GET("/register", UsersRegisterGet)
 		auth.POST("/register", UsersRegisterPost)
 		auth.GET("/login", UsersLoginGet)
 		auth.POST("/login", UsersLoginPost)
+		auth.GET("/login/two-factor", UsersLoginTwoFactorGet)
+		auth.POST("/login/two-factor", UsersLoginTwoFactorPost)
 		auth.GET("/logout", UsersLogout)
+		auth.GET("/auth/{provider}", UsersAuthStart)
+		auth.GET("/auth/{provider}/callback", UsersAuthCallback)
+		auth.GET("/forgot-password", UsersForgotPasswordGet)
+		auth.POST("/forgot-password", UsersForgotPasswordPost)
+		auth.GET("/reset-password/{token}", UsersResetPasswordGet)
+		auth.POST("/reset-password/{token}", UsersResetPasswordPost)
+		auth.GET("/verify-email/{token}", UsersVerifyEmail)
 		auth.GET("/settings", UserRequired(UsersSettings))
+		auth.GET("/autocomplete", UserRequired(UsersAutocomplete))
+		auth.GET("/settings/resend-verification", UserRequired(UsersSettingsResendVerification))
 		auth.GET("/show", UserRequired(UsersShow))
 		auth.GET("/settings/add-subscription/{cid}", UserRequired(UsersSettingsAddSubscription))
 		auth.GET("/settings/rm-subscription/{cid}", UserRequired(UsersSettingsRemoveSubscription))
@@ -81,13 +106,39 @@ func App() *buffalo.App {
 		auth.POST("/settings/update-name", UserRequired(UsersSettingsUpdateName))
 		auth.POST("/settings/update-email", UserRequired(UsersSettingsUpdateEmail))
 		auth.POST("/settings/update-password", UserRequired(UsersSettingsUpdatePassword))
+		auth.GET("/settings/two-factor", UserRequired(UsersSettingsTwoFactor))
+		auth.POST("/settings/two-factor/setup", UserRequired(UsersSettingsTwoFactorSetup))
+		auth.POST("/settings/two-factor/enable", UserRequired(UsersSettingsTwoFactorEnable))
+		auth.POST("/settings/two-factor/disable", UserRequired(UsersSettingsTwoFactorDisable))
+		auth.POST("/settings/two-factor/recovery-codes", UserRequired(UsersSettingsTwoFactorRecoveryCodes))
+		auth.POST("/settings/require-admin-two-factor", manageUsers(UsersSettingsRequireAdminTwoFactor))
+		auth.POST("/settings/reactions", manageUsers(UsersSettingsReactions))
+		auth.POST("/settings/tags", manageUsers(UsersSettingsTags))
+		auth.GET("/settings/roles", manageUsers(UsersSettingsRoles))
+		auth.POST("/settings/roles", manageUsers(UsersSettingsRolesCreate))
+		auth.POST("/settings/roles/update/{roleid}", manageUsers(UsersSettingsRolesUpdate))
+		auth.POST("/settings/roles/delete/{roleid}", manageUsers(UsersSettingsRolesDelete))
+		auth.POST("/settings/user-roles/{uid}", manageUsers(UsersSettingsUserRoles))
+		auth.POST("/settings/unlock/{uid}", manageUsers(UsersSettingsUnlock))
+		auth.POST("/settings/unlink-identity/{iid}", UserRequired(UsersSettingsUnlinkIdentity))
+		auth.POST("/settings/sessions/revoke/{sid}", UserRequired(UsersSettingsSessionsRevoke))
+		auth.POST("/settings/sessions/revoke-others", UserRequired(UsersSettingsSessionsRevokeOthers))
+		auth.GET("/settings/tokens", UserRequired(UsersSettingsTokens))
+		auth.POST("/settings/tokens", UserRequired(UsersSettingsTokensCreate))
+		auth.POST("/settings/tokens/revoke/{aid}", UserRequired(UsersSettingsTokensRevoke))
 
 		catGroup := app.Group("/categories")
 		catGroup.Use(UserRequired)
 		catGroup.GET("/index", CategoriesIndex)
-		catGroup.GET("/create", AdminRequired(CategoriesCreateGet))
-		catGroup.POST("/create", AdminRequired(CategoriesCreatePost))
+		catGroup.GET("/create", createCategory(CategoriesCreateGet))
+		catGroup.POST("/create", createCategory(CategoriesCreatePost))
 		catGroup.GET("/detail/{cid}", CategoriesDetail)
+		catGroup.POST("/read/{cid}", CategoriesMarkRead)
+		catGroup.GET("/edit/{cid}", createCategory(CategoriesEditGet))
+		catGroup.POST("/edit/{cid}", createCategory(CategoriesEditPost))
+		catGroup.POST("/delete/{cid}", createCategory(CategoriesDelete))
+		catGroup.POST("/moderators/{cid}", createCategory(CategoriesAddModerator))
+		catGroup.POST("/moderators/{cid}/remove/{uid}", createCategory(CategoriesRemoveModerator))
 
 		topicGroup := app.Group("/topics")
 		topicGroup.Use(UserRequired)
@@ -98,20 +149,62 @@ func App() *buffalo.App {
 		topicGroup.GET("/delete", TopicsDelete)
 		topicGroup.GET("/edit", TopicsEditGet)
 		topicGroup.POST("/edit", TopicsEditPost)
+		topicGroup.POST("/move/{tid}", TopicsMove)
+		topicGroup.POST("/merge/{tid}", TopicsMerge)
+		topicGroup.POST("/split/{tid}", TopicsSplit)
+		topicGroup.GET("/revisions/{tid}", TopicsRevisions)
+		topicGroup.POST("/revisions/{tid}/rollback/{revid}", TopicsRevisionsRollback)
+		topicGroup.POST("/state/{tid}", TopicsState)
+		topicGroup.POST("/react/{tid}", TopicsReact)
+		topicGroup.POST("/solve/{tid}", TopicsSolve)
+		topicGroup.POST("/vote/{tid}", TopicsVote)
 		topicGroup.GET("/add-subscriber/{tid}", UserRequired(TopicsAddSubscriber))
 		topicGroup.GET("/rm-subscriber/{tid}", UserRequired(TopicsRemoveSubscriber))
 
+		tagGroup := app.Group("/tags")
+		tagGroup.Use(UserRequired)
+		tagGroup.GET("/{tag}", TagsShow)
+		tagGroup.GET("/add-subscriber/{tag}", TagsAddSubscriber)
+		tagGroup.GET("/rm-subscriber/{tag}", TagsRemoveSubscriber)
+
 		replyGroup := app.Group("/replies")
 		replyGroup.Use(UserRequired)
 		replyGroup.GET("/create", RepliesCreateGet)
 		replyGroup.POST("/create", RepliesCreatePost)
 		replyGroup.GET("/edit", RepliesEditGet)
 		replyGroup.POST("/edit", RepliesEditPost)
+		replyGroup.GET("/revisions/{rid}", RepliesRevisions)
+		replyGroup.POST("/revisions/{rid}/rollback/{revid}", RepliesRevisionsRollback)
+		replyGroup.POST("/react/{rid}", RepliesReact)
 		replyGroup.GET("/delete", RepliesDelete)
 		replyGroup.GET("/detail", RepliesDetail)
+		replyGroup.GET("/locate/{rid}", RepliesLocate)
+
+		draftGroup := app.Group("/drafts")
+		draftGroup.Use(UserRequired)
+		draftGroup.POST("/save", DraftsSave)
+		draftGroup.GET("/load", DraftsLoad)
+		draftGroup.POST("/delete/{did}", DraftsDelete)
+
+		attGroup := app.Group("/attachments")
+		attGroup.Use(UserRequired)
+		attGroup.GET("/download/{aid}", AttachmentsDownload)
+		attGroup.GET("/thumbnail/{aid}", AttachmentsThumbnail)
 
 		app.GET("/search", UserRequired(Search))
 
+		api := app.Group("/api/v1")
+		api.Use(APIUserRequired)
+		api.GET("/categories", APICategoriesIndex)
+		api.GET("/categories/{cid}", APICategoriesDetail)
+		api.POST("/categories/{cid}/topics", APITopicsCreate)
+		api.GET("/topics/{tid}", APITopicsDetail)
+		api.PUT("/topics/{tid}", APITopicsUpdate)
+		api.DELETE("/topics/{tid}", APITopicsDelete)
+		api.POST("/topics/{tid}/replies", APIRepliesCreate)
+		api.PUT("/replies/{rid}", APIRepliesUpdate)
+		api.DELETE("/replies/{rid}", APIRepliesDelete)
+
 		// launch the db indexing
 		go runDBSearchIndex()
 	}
@@ -0,0 +1,386 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/go-saloon/saloon/storage"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+)
+
+// attachmentStore keeps the files attached to posts.
+var attachmentStore storage.Storage
+
+const (
+	thumbnailSize      = 240      // maximum width and height of thumbnails
+	maxThumbnailPixels = 50000000 // larger images get no thumbnail
+)
+
+// setupStorage configures the storage of attached files from the
+// environment.
+func setupStorage() error {
+	switch backend := envy.Get("SALOON_STORAGE", "local"); backend {
+	case "local":
+		attachmentStore = storage.NewLocal(envy.Get("SALOON_STORAGE_DIR", "attachments"))
+	default:
+		return errors.Errorf("unknown storage backend %q", backend)
+	}
+	return nil
+}
+
+// maxRequestBody is the maximum size of a request body, in bytes: enough
+// for a post with as many attachments as allowed.
+const maxRequestBody = models.MaxAttachments*models.MaxAttachmentSize + 1<<20
+
+// LimitRequestBody refuses to read request bodies larger than
+// maxRequestBody.
+func LimitRequestBody(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		req := c.Request()
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, maxRequestBody)
+		return next(c)
+	}
+}
+
+// attachmentFiles are the files a request wrote to and removed from the
+// attachment store.
+type attachmentFiles struct {
+	written []string
+	removed []string
+}
+
+// TrackAttachmentFiles keeps the attachment store in step with the
+// transaction of a request: files removed from posts are only deleted
+// once the transaction is committed, and files written are deleted again
+// when it is rolled back.
+// It must wrap the transaction middleware.
+func TrackAttachmentFiles(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		files := new(attachmentFiles)
+		c.Set("attachment_files", files)
+		err := next(c)
+		// the transaction is rolled back on errors and failure statuses.
+		keys := files.removed
+		if res, ok := c.Response().(*buffalo.Response); err != nil || (ok && (res.Status < 200 || res.Status >= 400)) {
+			keys = files.written
+		}
+		for _, key := range keys {
+			if derr := attachmentStore.Delete(c, key); derr != nil {
+				log.Printf("attachment store: could not delete %s: %v", key, derr)
+			}
+		}
+		return err
+	}
+}
+
+// trackedFiles returns the attachment files of the current request.
+func trackedFiles(c buffalo.Context) *attachmentFiles {
+	if files, ok := c.Value("attachment_files").(*attachmentFiles); ok {
+		return files
+	}
+	// without tracking, no file is ever deleted.
+	return new(attachmentFiles)
+}
+
+// upload is a file uploaded with a post form, not saved yet.
+type upload struct {
+	att  *models.Attachment
+	data []byte
+}
+
+// attachmentParams reads the files uploaded in the Attachments field of
+// a post form, and checks them against the limits on attachments.
+// post is the topic or reply being edited, if any: its attachments count
+// towards the limit, unless they are removed by the form.
+func attachmentParams(c buffalo.Context, post uuid.UUID) ([]upload, *validate.Errors, error) {
+	verrs := validate.NewErrors()
+	req := c.Request()
+	err := req.ParseMultipartForm(models.MaxAttachmentSize)
+	if err == http.ErrNotMultipart {
+		return nil, verrs, nil
+	}
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	kept := 0
+	if post != uuid.Nil {
+		tx := c.Value("tx").(*pop.Connection)
+		atts, err := models.PostAttachments(tx, post)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		removed := make(map[string]bool)
+		for _, id := range req.Form["RemoveAttachment"] {
+			removed[id] = true
+		}
+		for _, att := range atts {
+			if !removed[att.ID.String()] {
+				kept++
+			}
+		}
+	}
+
+	// the files are only read once their number is known to be allowed.
+	var files []*multipart.FileHeader
+	for _, fh := range req.MultipartForm.File["Attachments"] {
+		if fh.Filename != "" {
+			files = append(files, fh)
+		}
+	}
+	if kept+len(files) > models.MaxAttachments {
+		verrs.Add("attachments", fmt.Sprintf("A post can not have more than %d attachments.", models.MaxAttachments))
+		return nil, verrs, nil
+	}
+
+	var uploads []upload
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		// read one byte more than allowed, to detect larger files.
+		data, err := ioutil.ReadAll(io.LimitReader(f, models.MaxAttachmentSize+1))
+		f.Close()
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		att := &models.Attachment{
+			Name:        filepath.Base(strings.Replace(fh.Filename, `\`, "/", -1)),
+			ContentType: http.DetectContentType(data),
+			Size:        int64(len(data)),
+		}
+		aerrs, err := att.Validate(nil)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		verrs.Append(aerrs)
+		uploads = append(uploads, upload{att: att, data: data})
+	}
+	return uploads, verrs, nil
+}
+
+// saveAttachments attaches the uploaded files to a post of a topic.
+// Thumbnails are generated for images.
+// The files written are deleted again if the request fails.
+func saveAttachments(c buffalo.Context, topic, post uuid.UUID, uploads []upload) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	files := trackedFiles(c)
+	for _, up := range uploads {
+		att := up.att
+		att.TopicID, att.PostID, att.AuthorID = topic, post, usr.ID
+		var thumb []byte
+		if att.IsImage() {
+			var err error
+			thumb, err = thumbnail(up.data)
+			if err != nil {
+				log.Printf("attachment %q: no thumbnail: %v", att.Name, err)
+			}
+			att.Thumbnail = thumb != nil
+		}
+		if err := tx.Create(att); err != nil {
+			return errors.WithStack(err)
+		}
+		files.written = append(files.written, att.Key())
+		if err := attachmentStore.Put(c, att.Key(), bytes.NewReader(up.data)); err != nil {
+			return errors.WithStack(err)
+		}
+		if thumb != nil {
+			files.written = append(files.written, att.ThumbnailKey())
+			if err := attachmentStore.Put(c, att.ThumbnailKey(), bytes.NewReader(thumb)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// removeAttachments removes the attachments of a post selected in the
+// RemoveAttachment field of its edit form.
+// Their files are deleted once the request succeeds.
+func removeAttachments(c buffalo.Context, post uuid.UUID) error {
+	tx := c.Value("tx").(*pop.Connection)
+	atts, err := models.PostAttachments(tx, post)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	removed := make(map[string]bool)
+	for _, id := range c.Request().Form["RemoveAttachment"] {
+		removed[id] = true
+	}
+	files := trackedFiles(c)
+	for _, att := range atts {
+		if !removed[att.ID.String()] {
+			continue
+		}
+		if err := tx.Destroy(&att); err != nil {
+			return errors.WithStack(err)
+		}
+		files.removed = append(files.removed, att.Key(), att.ThumbnailKey())
+	}
+	return nil
+}
+
+// thumbnail returns a PNG thumbnail of an image, no larger than
+// thumbnailSize in either dimension.
+func thumbnail(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, errors.Errorf("image too large (%dx%d)", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailSize || h > thumbnailSize {
+		if w > h {
+			w, h = thumbnailSize, h*thumbnailSize/w
+		} else {
+			w, h = w*thumbnailSize/h, thumbnailSize
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, dst); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setAttachments makes the files attached to a topic and its replies
+// available to templates, keyed by post ID.
+func setAttachments(c buffalo.Context, topic *models.Topic) error {
+	tx := c.Value("tx").(*pop.Connection)
+	atts := models.Attachments{}
+	if err := tx.Where("topic_id = ?", topic.ID).Order("created_at asc").All(&atts); err != nil {
+		return errors.WithStack(err)
+	}
+	posts := atts.ByPost()
+	// templates can not range over missing entries.
+	if _, ok := posts[topic.ID.String()]; !ok {
+		posts[topic.ID.String()] = nil
+	}
+	for _, reply := range topic.Replies {
+		if _, ok := posts[reply.ID.String()]; !ok {
+			posts[reply.ID.String()] = nil
+		}
+	}
+	c.Set("attachments", posts)
+	return nil
+}
+
+// findAttachment retrieves the attachment given by the aid parameter.
+// Attachments of deleted posts are only available to moderators.
+func findAttachment(c buffalo.Context) (*models.Attachment, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	att := new(models.Attachment)
+	if err := tx.Find(att, c.Param("aid")); err != nil {
+		return nil, c.Error(404, err)
+	}
+	topic := new(models.Topic)
+	if err := tx.Find(topic, att.TopicID); err != nil {
+		return nil, c.Error(404, err)
+	}
+	deleted := topic.Deleted
+	if att.PostID != att.TopicID {
+		reply := new(models.Reply)
+		if err := tx.Find(reply, att.PostID); err != nil {
+			return nil, c.Error(404, err)
+		}
+		deleted = deleted || reply.Deleted
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if usr := c.Value("current_user").(*models.User); deleted && !usr.Moderates(cat) {
+		return nil, c.Error(404, errors.Errorf("no attachment %s", att.ID))
+	}
+	return att, nil
+}
+
+// serveAttachment writes the file stored under key to the response.
+func serveAttachment(c buffalo.Context, key, ctype, disposition, name string) error {
+	f, err := attachmentStore.Open(c, key)
+	if err == storage.ErrNotExist {
+		return c.Error(404, err)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	h := c.Response().Header()
+	h.Set("Content-Type", ctype)
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": name}); v != "" {
+		h.Set("Content-Disposition", v)
+	} else {
+		h.Set("Content-Disposition", disposition)
+	}
+	// uploaded files are never interpreted as active content.
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; sandbox")
+	h.Set("Cache-Control", "private, max-age=86400")
+	c.Response().WriteHeader(200)
+	_, err = io.Copy(c.Response(), f)
+	return errors.WithStack(err)
+}
+
+// AttachmentsDownload serves an attached file.
+// Images and text files are displayed inline, other files are downloaded.
+func AttachmentsDownload(c buffalo.Context) error {
+	att, err := findAttachment(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	disposition := "attachment"
+	if att.Inline() {
+		disposition = "inline"
+	}
+	return serveAttachment(c, att.Key(), att.ContentType, disposition, att.Name)
+}
+
+// AttachmentsThumbnail serves the thumbnail of an attached image.
+func AttachmentsThumbnail(c buffalo.Context) error {
+	att, err := findAttachment(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !att.Thumbnail {
+		return c.Error(404, errors.Errorf("no thumbnail for attachment %s", att.ID))
+	}
+	return serveAttachment(c, att.ThumbnailKey(), "image/png", "inline", att.Name+".png")
+}
@@ -5,12 +5,17 @@
 package actions
 
 import (
+	"database/sql"
+	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-saloon/saloon/mailers"
 	"github.com/go-saloon/saloon/models"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/pkg/errors"
 )
@@ -34,23 +39,32 @@ type CategoriesResource struct {
 
 func CategoriesIndex(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
-	cats := &models.Categories{}
-	// Paginate results. Params "page" and "per_page" control pagination.
-	// Default values are "page=1" and "per_page=20".
-	q := tx.PaginateFromParams(c.Params())
-	// Retrieve all Categories from the DB
-	if err := q.All(cats); err != nil {
+	cats, err := allCategories(tx)
+	if err != nil {
 		return errors.WithStack(err)
 	}
-	sort.Sort(cats)
-	// Make categories available inside the html template
-	c.Set("categories", cats)
-	// Add the paginator to the context so it can be used in the template.
-	c.Set("pagination", q.Paginator)
+	// Make the category tree available inside the html template
+	c.Set("categories", cats.Tree())
 	return c.Render(200, r.HTML("categories/index"))
 }
 
+// allCategories retrieves all the categories.
+func allCategories(tx *pop.Connection) (models.Categories, error) {
+	cats := models.Categories{}
+	if err := tx.All(&cats); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sort.Sort(cats)
+	return cats, nil
+}
+
 func CategoriesCreateGet(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cats, err := allCategories(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("parents", cats.Tree())
 	c.Set("category", &models.Category{})
 	return c.Render(200, r.HTML("categories/create"))
 }
@@ -62,6 +76,11 @@ func CategoriesCreatePost(c buffalo.Context) error {
 	if err := c.Bind(cat); err != nil {
 		return errors.WithStack(err)
 	}
+	parent, err := parentParam(c)
+	if err != nil {
+		return c.Error(400, err)
+	}
+	cat.ParentCategory = parent
 	// Get the DB connection from the context
 	tx := c.Value("tx").(*pop.Connection)
 	// Validate the data from the html form
@@ -70,6 +89,11 @@ func CategoriesCreatePost(c buffalo.Context) error {
 		return errors.WithStack(err)
 	}
 	if verrs.HasAny() {
+		cats, err := allCategories(tx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("parents", cats.Tree())
 		c.Set("category", cat)
 		c.Set("errors", verrs.Errors)
 		return c.Render(422, r.HTML("categories/create"))
@@ -80,260 +104,316 @@ func CategoriesCreatePost(c buffalo.Context) error {
 	return c.Redirect(302, "/categories/index")
 }
 
-// CategoriesDetail displays the list of topics in a category
-func CategoriesDetail(c buffalo.Context) error {
+// parentParam returns the parent category selected in a category form.
+func parentParam(c buffalo.Context) (nulls.UUID, error) {
+	pid := c.Param("ParentID")
+	if pid == "" {
+		return nulls.UUID{}, nil
+	}
+	id, err := uuid.FromString(pid)
+	if err != nil {
+		return nulls.UUID{}, errors.WithStack(err)
+	}
+	return nulls.NewUUID(id), nil
+}
+
+// CategoriesEditGet displays a form to edit a category.
+func CategoriesEditGet(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
-	cat := &models.Category{}
+	cat := new(models.Category)
 	if err := tx.Find(cat, c.Param("cid")); err != nil {
 		return c.Error(404, err)
 	}
-	c.Set("category", cat)
-	topics := &models.Topics{}
-	if err := tx.BelongsTo(cat).All(topics); err != nil {
-		return c.Error(404, err)
+	return renderCategoryEdit(c, 200, cat)
+}
+
+func renderCategoryEdit(c buffalo.Context, status int, cat *models.Category) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cats, err := allCategories(tx)
+	if err != nil {
+		return errors.WithStack(err)
 	}
-	c.Set("topics", topics)
-	for i, t := range *topics {
-		topic, err := loadTopic(c, t.ID.String())
-		if err != nil {
-			return errors.WithStack(err)
+	var others []models.CategoryNode
+	for _, node := range cats.Tree() {
+		if node.ID != cat.ID {
+			others = append(others, node)
 		}
-		(*topics)[i] = *topic
 	}
-	return c.Render(200, r.HTML("categories/detail"))
+	c.Set("category", cat)
+	c.Set("parents", others)
+	return c.Render(status, r.HTML("categories/edit"))
 }
 
-func newTopicNotify(c buffalo.Context, topic *models.Topic) error {
-	set := make(map[uuid.UUID]struct{})
-	for _, usr := range topic.Subscribers {
-		set[usr] = struct{}{}
-	}
-	set[topic.AuthorID] = struct{}{}
-
-	cat := new(models.Category)
+// CategoriesEditPost renames a category, or changes its description,
+// parent, position or archival status.
+func CategoriesEditPost(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
-	if err := tx.Find(cat, topic.CategoryID); err != nil {
+	cat := new(models.Category)
+	if err := tx.Find(cat, c.Param("cid")); err != nil {
+		return c.Error(404, err)
+	}
+	// only the fields of the form may be modified.
+	subs, mods := cat.Subscribers, cat.Moderators
+	if err := c.Bind(cat); err != nil {
 		return errors.WithStack(err)
 	}
-	for _, usr := range cat.Subscribers {
-		set[usr] = struct{}{}
+	cat.Subscribers, cat.Moderators = subs, mods
+	parent, err := parentParam(c)
+	if err != nil {
+		return c.Error(400, err)
 	}
-
-	users := new(models.Users)
-	if err := tx.All(users); err != nil {
+	cat.ParentCategory = parent
+	cat.Archived = c.Param("Archived") == "true"
+	verrs, err := tx.ValidateAndUpdate(cat)
+	if err != nil {
 		return errors.WithStack(err)
 	}
-
-	var recpts []models.User
-	for _, usr := range *users {
-		if _, ok := set[usr.ID]; !ok {
-			continue
-		}
-		recpts = append(recpts, usr)
+	if verrs.HasAny() {
+		c.Set("errors", verrs.Errors)
+		return renderCategoryEdit(c, 422, cat)
 	}
+	c.Flash().Add("success", "Category updated successfully.")
+	return c.Redirect(302, "/categories/detail/%s", cat.ID)
+}
 
-	err := mailers.NewTopicNotify(c, topic, recpts)
+// CategoriesDelete deletes a category, after moving its topics to another
+// category. Its subcategories are moved to its parent.
+func CategoriesDelete(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cat := new(models.Category)
+	if err := tx.Find(cat, c.Param("cid")); err != nil {
+		return c.Error(404, err)
+	}
+	dst := new(models.Category)
+	if err := tx.Find(dst, c.Param("TargetID")); err != nil || dst.ID == cat.ID {
+		c.Flash().Add("danger", "Choose the category the topics will be moved to.")
+		return c.Redirect(302, "/categories/edit/%s", cat.ID)
+	}
+	err := tx.RawQuery("UPDATE topics SET category_id = ? WHERE category_id = ?", dst.ID, cat.ID).Exec()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	return nil
-}
-
-/*
-// List gets all Categories. This function is mapped to the path
-// GET /categories
-func (v CategoriesResource) List(c buffalo.Context) error {
-	// Get the DB connection from the context
-	tx, ok := c.Value("tx").(*pop.Connection)
-	if !ok {
-		return errors.WithStack(errors.New("no transaction found"))
+	err = tx.RawQuery("UPDATE categories SET parent_category = ? WHERE parent_category = ?", cat.ParentCategory, cat.ID).Exec()
+	if err != nil {
+		return errors.WithStack(err)
 	}
-
-	categories := &models.Categories{}
-
-	// Paginate results. Params "page" and "per_page" control pagination.
-	// Default values are "page=1" and "per_page=20".
-	q := tx.PaginateFromParams(c.Params())
-
-	// Retrieve all Categories from the DB
-	if err := q.All(categories); err != nil {
+	err = tx.RawQuery("UPDATE users SET subscriptions = array_remove(subscriptions, ?)", cat.ID.String()).Exec()
+	if err != nil {
 		return errors.WithStack(err)
 	}
-
-	// Make Categories available inside the html template
-	c.Set("categories", categories)
-
-	// Add the paginator to the context so it can be used in the template.
-	c.Set("pagination", q.Paginator)
-
-	return c.Render(200, r.HTML("categories/index.html"))
-}
-
-// Show gets the data for one Category. This function is mapped to
-// the path GET /categories/{category_id}
-func (v CategoriesResource) Show(c buffalo.Context) error {
-	// Get the DB connection from the context
-	tx, ok := c.Value("tx").(*pop.Connection)
-	if !ok {
-		return errors.WithStack(errors.New("no transaction found"))
+	if err := tx.Destroy(cat); err != nil {
+		return errors.WithStack(err)
 	}
+	c.Flash().Add("success", fmt.Sprintf("Category deleted. Its topics were moved to %s.", dst.Title))
+	return c.Redirect(302, "/categories/index")
+}
 
-	// Allocate an empty Category
-	category := &models.Category{}
-
-	// To find the Category the parameter category_id is used.
-	if err := tx.Find(category, c.Param("category_id")); err != nil {
+// CategoriesDetail displays the list of topics in a category
+func CategoriesDetail(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cat := &models.Category{}
+	if err := tx.Find(cat, c.Param("cid")); err != nil {
 		return c.Error(404, err)
 	}
-
-	// Make category available inside the html template
-	c.Set("category", category)
-
-	return c.Render(200, r.HTML("categories/show.html"))
-}
-
-// New renders the form for creating a new Category.
-// This function is mapped to the path GET /categories/new
-func (v CategoriesResource) New(c buffalo.Context) error {
-	// Make category available inside the html template
-	c.Set("category", &models.Category{})
-
-	return c.Render(200, r.HTML("categories/new.html"))
-}
-
-// Create adds a Category to the DB. This function is mapped to the
-// path POST /categories
-func (v CategoriesResource) Create(c buffalo.Context) error {
-	// Allocate an empty Category
-	category := &models.Category{}
-
-	// Bind category to the html form elements
-	if err := c.Bind(category); err != nil {
+	c.Set("category", cat)
+	cats, err := allCategories(tx)
+	if err != nil {
 		return errors.WithStack(err)
 	}
-
-	// Get the DB connection from the context
-	tx, ok := c.Value("tx").(*pop.Connection)
-	if !ok {
-		return errors.WithStack(errors.New("no transaction found"))
+	c.Set("breadcrumbs", cats.Ancestors(cat.ID))
+	var subcats models.Categories
+	for _, sub := range cats {
+		if sub.ParentCategory.Valid && sub.ParentCategory.UUID == cat.ID {
+			subcats = append(subcats, sub)
+		}
 	}
-
-	// Validate the data from the html form
-	verrs, err := tx.ValidateAndCreate(category)
+	c.Set("subcategories", subcats)
+	topics := &models.Topics{}
+	if err := tx.Where("category_id = ? AND deleted = false", cat.ID).All(topics); err != nil {
+		return errors.WithStack(err)
+	}
+	// globally pinned topics are listed in every category.
+	pinned := &models.Topics{}
+	if err := tx.Where("pinned = ? AND category_id != ? AND deleted = false", models.PinGlobal, cat.ID).All(pinned); err != nil {
+		return errors.WithStack(err)
+	}
+	*topics = append(*topics, *pinned...)
+	// unlisted topics are only listed for moderators.
+	if usr := c.Value("current_user").(*models.User); !usr.Moderates(cat) {
+		listed := (*topics)[:0]
+		for _, t := range *topics {
+			if !t.Unlisted {
+				listed = append(listed, t)
+			}
+		}
+		*topics = listed
+	}
+	c.Set("topics", topics)
+	c.Set("sort", c.Param("sort"))
+	if c.Param("sort") == "reactions" {
+		topics.SortByReactions()
+	}
+	c.Set("filter", c.Param("filter"))
+	if c.Param("filter") == "unsolved" {
+		*topics = topics.Unsolved()
+	}
+	c.Set("tags", topics.Tags())
+	tag := models.NormalizeTag(c.Param("tag"))
+	c.Set("tag", tag)
+	if tag != "" {
+		*topics = topics.Tagged(tag)
+	}
+	topics.PinnedFirst()
+	listings, err := listTopics(tx, *topics)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-
-	if verrs.HasAny() {
-		// Make category available inside the html template
-		c.Set("category", category)
-
-		// Make the errors available inside the html template
-		c.Set("errors", verrs)
-
-		// Render again the new.html template that the user can
-		// correct the input.
-		return c.Render(422, r.HTML("categories/new.html"))
+	c.Set("listings", listings)
+	reads, err := models.LoadReadState(tx, c.Value("current_user").(*models.User), *topics)
+	if err != nil {
+		return errors.WithStack(err)
 	}
-
-	// If there are no errors set a success message
-	c.Flash().Add("success", "Category was created successfully")
-
-	// and redirect to the categories index page
-	return c.Redirect(302, "/categories/%s", category.ID)
-}
-
-// Edit renders a edit form for a Category. This function is
-// mapped to the path GET /categories/{category_id}/edit
-func (v CategoriesResource) Edit(c buffalo.Context) error {
-	// Get the DB connection from the context
-	tx, ok := c.Value("tx").(*pop.Connection)
-	if !ok {
-		return errors.WithStack(errors.New("no transaction found"))
+	if err := reads.CountUnread(tx, *topics); err != nil {
+		return errors.WithStack(err)
 	}
+	c.Set("reads", reads)
+	mods, err := categoryModerators(tx, cat)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("moderators", mods)
+	return c.Render(200, r.HTML("categories/detail"))
+}
 
-	// Allocate an empty Category
-	category := &models.Category{}
-
-	if err := tx.Find(category, c.Param("category_id")); err != nil {
+// CategoriesMarkRead marks every post of a category as read by the
+// current user.
+func CategoriesMarkRead(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cat := new(models.Category)
+	if err := tx.Find(cat, c.Param("cid")); err != nil {
 		return c.Error(404, err)
 	}
-
-	// Make category available inside the html template
-	c.Set("category", category)
-	return c.Render(200, r.HTML("categories/edit.html"))
+	usr := c.Value("current_user").(*models.User)
+	if err := models.MarkCategoryRead(tx, usr.ID, cat.ID, time.Now()); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Category marked as read.")
+	return c.Redirect(302, "/categories/detail/%s", cat.ID)
 }
 
-// Update changes a Category in the DB. This function is mapped to
-// the path PUT /categories/{category_id}
-func (v CategoriesResource) Update(c buffalo.Context) error {
-	// Get the DB connection from the context
-	tx, ok := c.Value("tx").(*pop.Connection)
-	if !ok {
-		return errors.WithStack(errors.New("no transaction found"))
+// categoryModerators returns the moderators of a category.
+func categoryModerators(tx *pop.Connection, cat *models.Category) (models.Users, error) {
+	var mods models.Users
+	if len(cat.Moderators) == 0 {
+		return mods, nil
 	}
+	users := new(models.Users)
+	if err := tx.All(users); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, usr := range *users {
+		if cat.HasModerator(usr.ID) {
+			mods = append(mods, usr)
+		}
+	}
+	sort.Sort(mods)
+	return mods, nil
+}
 
-	// Allocate an empty Category
-	category := &models.Category{}
-
-	if err := tx.Find(category, c.Param("category_id")); err != nil {
+// CategoriesAddModerator makes a user moderator of a category.
+func CategoriesAddModerator(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cat := new(models.Category)
+	if err := tx.Find(cat, c.Param("cid")); err != nil {
 		return c.Error(404, err)
 	}
-
-	// Bind Category to the html form elements
-	if err := c.Bind(category); err != nil {
+	usr := new(models.User)
+	if err := tx.Where("username = ?", strings.ToLower(c.Param("Username"))).First(usr); err != nil {
+		if errors.Cause(err) != sql.ErrNoRows {
+			return errors.WithStack(err)
+		}
+		c.Flash().Add("danger", fmt.Sprintf("No user named %q.", c.Param("Username")))
+		return c.Redirect(302, "/categories/detail/%s", cat.ID)
+	}
+	cat.AddModerator(usr.ID)
+	if err := tx.Update(cat); err != nil {
 		return errors.WithStack(err)
 	}
+	c.Flash().Add("success", fmt.Sprintf("%s now moderates this category.", usr.Username))
+	return c.Redirect(302, "/categories/detail/%s", cat.ID)
+}
 
-	verrs, err := tx.ValidateAndUpdate(category)
+// CategoriesRemoveModerator revokes the moderation rights of a user on
+// a category.
+func CategoriesRemoveModerator(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cat := new(models.Category)
+	if err := tx.Find(cat, c.Param("cid")); err != nil {
+		return c.Error(404, err)
+	}
+	uid, err := uuid.FromString(c.Param("uid"))
 	if err != nil {
+		return c.Error(404, err)
+	}
+	cat.RemoveModerator(uid)
+	if err := tx.Update(cat); err != nil {
 		return errors.WithStack(err)
 	}
+	return c.Redirect(302, "/categories/detail/%s", cat.ID)
+}
 
-	if verrs.HasAny() {
-		// Make category available inside the html template
-		c.Set("category", category)
-
-		// Make the errors available inside the html template
-		c.Set("errors", verrs)
-
-		// Render again the edit.html template that the user can
-		// correct the input.
-		return c.Render(422, r.HTML("categories/edit.html"))
+func newTopicNotify(c buffalo.Context, topic *models.Topic) error {
+	set := make(map[uuid.UUID]struct{})
+	for _, usr := range topic.Subscribers {
+		set[usr] = struct{}{}
 	}
+	set[topic.AuthorID] = struct{}{}
 
-	// If there are no errors set a success message
-	c.Flash().Add("success", "Category was updated successfully")
-
-	// and redirect to the categories index page
-	return c.Redirect(302, "/categories/%s", category.ID)
-}
-
-// Destroy deletes a Category from the DB. This function is mapped
-// to the path DELETE /categories/{category_id}
-func (v CategoriesResource) Destroy(c buffalo.Context) error {
-	// Get the DB connection from the context
-	tx, ok := c.Value("tx").(*pop.Connection)
-	if !ok {
-		return errors.WithStack(errors.New("no transaction found"))
+	// subscribers of a category also follow its subcategories.
+	tx := c.Value("tx").(*pop.Connection)
+	cats, err := allCategories(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, usr := range cats.Subscribers(topic.CategoryID) {
+		set[usr] = struct{}{}
 	}
 
-	// Allocate an empty Category
-	category := &models.Category{}
+	users := new(models.Users)
+	if err := tx.All(users); err != nil {
+		return errors.WithStack(err)
+	}
+	// subscribers of a tag follow the topics tagged with it.
+	for _, usr := range *users {
+		if usr.FollowsTags(topic.Tags) {
+			set[usr.ID] = struct{}{}
+		}
+	}
 
-	// To find the Category the parameter category_id is used.
-	if err := tx.Find(category, c.Param("category_id")); err != nil {
-		return c.Error(404, err)
+	var recpts []models.User
+	for _, usr := range *users {
+		if _, ok := set[usr.ID]; !ok {
+			continue
+		}
+		if !usr.EmailVerified {
+			continue
+		}
+		recpts = append(recpts, usr)
 	}
 
-	if err := tx.Destroy(category); err != nil {
+	err = mailers.NewTopicNotify(c, topic, recpts)
+	if err != nil {
 		return errors.WithStack(err)
 	}
+	return mentionNotify(c, topic, uuid.Nil, topic.Author, topic.Content, "", set)
+}
 
-	// If there are no errors set a flash message
-	c.Flash().Add("success", "Category was destroyed successfully")
-
-	// Redirect to the categories index page
-	return c.Redirect(302, "/categories")
+// refuseArchived refuses a request that would change the posts of the
+// topic tid, in an archived category: archived categories are read-only.
+func refuseArchived(c buffalo.Context, tid uuid.UUID) error {
+	if isAPIRequest(c.Request()) {
+		return apiError(c, 403, "category is archived")
+	}
+	c.Flash().Add("danger", "This category is archived: its posts can not be changed.")
+	return c.Redirect(302, "/topics/detail/%s", tid)
 }
-*/
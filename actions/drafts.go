@@ -0,0 +1,153 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/pkg/errors"
+)
+
+// maxDraftSize is the maximum size of the title and content of a draft,
+// in bytes.
+const maxDraftSize = 1 << 20
+
+// draftContext returns an empty draft of the current user, for the
+// context given by the cid parameter, for a new topic, or by the tid
+// parameter, for a reply.
+// The category or topic must accept new posts.
+func draftContext(c buffalo.Context) (*models.Draft, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	draft := &models.Draft{UserID: usr.ID}
+	switch {
+	case c.Param("cid") != "":
+		cat := new(models.Category)
+		if err := tx.Find(cat, c.Param("cid")); err != nil {
+			return nil, c.Error(404, err)
+		}
+		if cat.Archived {
+			return nil, c.Error(403, errors.Errorf("category %s is archived", cat.ID))
+		}
+		draft.Context = models.TopicDraftContext(cat.ID)
+		draft.CategoryID = nulls.NewUUID(cat.ID)
+	case c.Param("tid") != "":
+		topic := new(models.Topic)
+		if err := tx.Find(topic, c.Param("tid")); err != nil || topic.Deleted {
+			return nil, c.Error(404, errors.Errorf("no topic %s", c.Param("tid")))
+		}
+		cat, err := findCategory(tx, topic.CategoryID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !topic.AcceptsReplies() || cat.Archived {
+			return nil, c.Error(403, errors.Errorf("topic %s does not accept replies", topic.ID))
+		}
+		draft.Context = models.ReplyDraftContext(topic.ID)
+		draft.TopicID = nulls.NewUUID(topic.ID)
+	default:
+		return nil, c.Error(400, errors.New("no draft context"))
+	}
+	return draft, nil
+}
+
+// DraftsSave saves the draft of the current user, from the Title and
+// Content parameters. The context of the draft is given by the cid or
+// tid parameter.
+// Saving an empty draft deletes it.
+func DraftsSave(c buffalo.Context) error {
+	draft, err := draftContext(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	draft.Title, draft.Content = c.Param("Title"), c.Param("Content")
+	if len(draft.Title)+len(draft.Content) > maxDraftSize {
+		return c.Error(413, errors.New("draft too large"))
+	}
+	tx := c.Value("tx").(*pop.Connection)
+	if err := models.SaveDraft(tx, draft); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(200, r.JSON(map[string]interface{}{
+		"saved":      !draft.Empty(),
+		"updated_at": draft.UpdatedAt,
+	}))
+}
+
+// DraftsLoad returns, as JSON, the draft of the current user in the
+// context given by the cid or tid parameter.
+func DraftsLoad(c buffalo.Context) error {
+	draft, err := draftContext(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tx := c.Value("tx").(*pop.Connection)
+	saved, err := models.FindDraft(tx, draft.UserID, draft.Context)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if saved == nil {
+		return c.Render(404, r.JSON(map[string]interface{}{"error": "no draft"}))
+	}
+	return c.Render(200, r.JSON(saved))
+}
+
+// DraftsDelete discards a draft of the current user.
+func DraftsDelete(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	draft := new(models.Draft)
+	if err := tx.Find(draft, c.Param("did")); err != nil || draft.UserID != usr.ID {
+		return c.Error(404, errors.Errorf("no draft %s", c.Param("did")))
+	}
+	if err := tx.Destroy(draft); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Draft discarded.")
+	return c.Redirect(302, "/users/settings")
+}
+
+// restoreDraft returns the draft of the current user in a context, or
+// nil if there is none. The draft is made available to templates.
+func restoreDraft(c buffalo.Context, context string) (*models.Draft, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	draft, err := models.FindDraft(tx, usr.ID, context)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.Set("hasDraft", draft != nil)
+	if draft != nil {
+		c.Set("draft", draft)
+	}
+	return draft, nil
+}
+
+// userDrafts returns the drafts of a user, most recent first, with their
+// category or topic.
+func userDrafts(tx *pop.Connection, usr *models.User) (models.Drafts, error) {
+	drafts := models.Drafts{}
+	if err := tx.Where("user_id = ?", usr.ID).Order("updated_at desc").All(&drafts); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i := range drafts {
+		d := &drafts[i]
+		switch {
+		case d.TopicID.Valid:
+			topic := new(models.Topic)
+			if err := tx.Find(topic, d.TopicID.UUID); err == nil && !topic.Deleted {
+				d.Topic = topic
+			}
+		case d.CategoryID.Valid:
+			cat := new(models.Category)
+			if err := tx.Find(cat, d.CategoryID.UUID); err == nil {
+				d.Category = cat
+			}
+		}
+	}
+	return drafts, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"strings"
+
+	"github.com/go-saloon/saloon/mailers"
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// autocompleteLimit is the maximum number of usernames suggested.
+const autocompleteLimit = 10
+
+// mentionNotify notifies the users mentioned in a post written by author.
+// post is the ID of the reply, or uuid.Nil for the topic itself.
+// Users already mentioned in the previous version prev of the post, and
+// the users in notified, are not notified again.
+func mentionNotify(c buffalo.Context, topic *models.Topic, post uuid.UUID, author *models.User, content, prev string, notified map[uuid.UUID]struct{}) error {
+	old := make(map[string]bool)
+	for _, name := range models.Mentions(prev) {
+		old[name] = true
+	}
+	var names []interface{}
+	for _, name := range models.Mentions(content) {
+		if !old[name] && name != author.Username {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	tx := c.Value("tx").(*pop.Connection)
+	users := new(models.Users)
+	if err := tx.Where("username IN (?)", names...).All(users); err != nil {
+		return errors.WithStack(err)
+	}
+	var recpts []models.User
+	for _, usr := range *users {
+		if _, ok := notified[usr.ID]; ok {
+			continue
+		}
+		if !usr.EmailVerified {
+			continue
+		}
+		recpts = append(recpts, usr)
+	}
+	if len(recpts) == 0 {
+		return nil
+	}
+	return mailers.SendMention(c, topic, post, author, content, recpts)
+}
+
+// UsersAutocomplete returns, as JSON, the usernames starting with the q
+// parameter, for @mentions.
+func UsersAutocomplete(c buffalo.Context) error {
+	q := strings.ToLower(strings.TrimPrefix(c.Param("q"), "@"))
+	names := []string{}
+	if q == "" {
+		return c.Render(200, r.JSON(names))
+	}
+	// escape the LIKE wildcards.
+	q = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q)
+	tx := c.Value("tx").(*pop.Connection)
+	users := new(models.Users)
+	err := tx.Where("username LIKE ?", q+"%").Order("username asc").Limit(autocompleteLimit).All(users)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, usr := range *users {
+		names = append(names, usr.Username)
+	}
+	return c.Render(200, r.JSON(names))
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// topicRef matches the ID of a topic, alone or in the URL of the topic.
+var topicRef = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// moveTargets returns the categories the user may move a topic to: the
+// categories the user moderates, other than the category of the topic,
+// that are not archived.
+func moveTargets(c buffalo.Context, usr *models.User, topic *models.Topic) (models.Categories, error) {
+	cats, err := moderatedCategories(c, usr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var targets models.Categories
+	for _, cat := range cats {
+		if cat.ID != topic.CategoryID && !cat.Archived {
+			targets = append(targets, cat)
+		}
+	}
+	return targets, nil
+}
+
+// setEditTargets makes the categories a topic of the category cat may be
+// moved to from its edit form available to templates. Only moderators
+// may move topics.
+func setEditTargets(c buffalo.Context, topic *models.Topic, cat *models.Category) error {
+	usr := c.Value("current_user").(*models.User)
+	var targets models.Categories
+	if usr.Moderates(cat) {
+		var err error
+		if targets, err = moveTargets(c, usr, topic); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	c.Set("category", cat)
+	c.Set("moveTargets", targets)
+	return nil
+}
+
+// moveDestination retrieves the category cid, to which the user moves
+// posts from the category src. A non-empty reason is returned if the user
+// may not do so.
+func moveDestination(c buffalo.Context, usr *models.User, src *models.Category, cid string) (*models.Category, string, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	dst := new(models.Category)
+	if err := tx.Find(dst, cid); err != nil {
+		return nil, "", c.Error(404, err)
+	}
+	if !usr.Moderates(src) || !usr.Moderates(dst) {
+		return nil, "You are not authorized to move this topic", nil
+	}
+	if dst.Archived {
+		return nil, "Topics can not be moved to an archived category.", nil
+	}
+	return dst, "", nil
+}
+
+// TopicsMove moves a topic to another category.
+// The user must moderate both categories.
+func TopicsMove(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("tid")); err != nil {
+		return c.Error(404, err)
+	}
+	src, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dst, reason, err := moveDestination(c, usr, src, c.Param("CategoryID"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if reason != "" {
+		c.Flash().Add("danger", reason)
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if err := models.MoveTopic(tx, topic, dst.ID, usr.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := reindexTopic(tx, topic.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Topic moved successfully.")
+	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+}
+
+// TopicsMerge merges a topic into the topic given by the Target
+// parameter, either its ID or its URL.
+// The replies of both topics are kept in chronological order, and the
+// merged topic redirects to the target topic.
+// The user must moderate the categories of both topics.
+func TopicsMerge(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	src, err := loadTopic(c, c.Param("tid"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ref := topicRef.FindString(c.Param("Target"))
+	if ref == "" {
+		c.Flash().Add("danger", "Give the URL of the topic to merge this topic into.")
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	}
+	dst, err := loadTopic(c, strings.ToLower(ref))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	switch {
+	case !usr.Moderates(src.Category) || !usr.Moderates(dst.Category):
+		c.Flash().Add("danger", "You are not authorized to merge this topic")
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	case src.Deleted || src.MergedInto.Valid:
+		c.Flash().Add("danger", "A deleted topic can not be merged.")
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	case dst.ID == src.ID || dst.Deleted:
+		c.Flash().Add("danger", "This topic can not be merged into the topic given.")
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	case dst.Category.Archived:
+		c.Flash().Add("danger", "Topics can not be merged into a topic of an archived category.")
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	}
+	// deleted replies, left out of src.Replies, are indexed too.
+	replies := models.Replies{}
+	if err := tx.Where("topic_id = ?", src.ID).All(&replies); err != nil {
+		return errors.WithStack(err)
+	}
+	moved := make([]uuid.UUID, 0, len(replies))
+	for _, reply := range replies {
+		moved = append(moved, reply.ID)
+	}
+	if err := models.MergeTopic(tx, src, dst, usr.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := reindexTopic(tx, src.ID, moved...); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := reindexTopic(tx, dst.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Topic merged successfully.")
+	return c.Redirect(302, "/topics/detail/%s", dst.ID)
+}
+
+// TopicsSplit moves the replies given by the rid parameters to a new
+// topic, titled by the Title parameter, in the category given by the
+// CategoryID parameter, or else in the category of the topic.
+// The user must moderate both categories.
+func TopicsSplit(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	src := new(models.Topic)
+	if err := tx.Find(src, c.Param("tid")); err != nil {
+		return c.Error(404, err)
+	}
+	cat, err := findCategory(tx, src.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if src.Deleted || src.MergedInto.Valid {
+		c.Flash().Add("danger", "Replies can not be split from a deleted topic.")
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	}
+	cid := c.Param("CategoryID")
+	if cid == "" {
+		cid = cat.ID.String()
+	}
+	dst, reason, err := moveDestination(c, usr, cat, cid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if reason != "" {
+		c.Flash().Add("danger", reason)
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	}
+	if err := c.Request().ParseForm(); err != nil {
+		return errors.WithStack(err)
+	}
+	var rids []uuid.UUID
+	for _, id := range c.Request().Form["rid"] {
+		rid, err := uuid.FromString(id)
+		if err != nil {
+			return c.Error(400, err)
+		}
+		rids = append(rids, rid)
+	}
+	topic, verrs, err := models.SplitTopic(tx, src, rids, c.Param("Title"), dst.ID, usr.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		for _, msgs := range verrs.Errors {
+			for _, msg := range msgs {
+				c.Flash().Add("danger", msg)
+			}
+		}
+		return c.Redirect(302, "/topics/detail/%s", src.ID)
+	}
+	if err := reindexTopic(tx, src.ID, rids...); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := reindexTopic(tx, topic.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Replies split into a new topic successfully.")
+	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+}
+
+// RepliesLocate redirects to the post given by the rid parameter, in the
+// topic it belongs to now.
+// It resolves links to posts that were moved by a merge or a split: their
+// IDs are kept, but their topic changed.
+// The from parameter gives the topic the link pointed to: posts still in
+// it, such as deleted replies, lead back to the topic alone so that the
+// missing anchor does not send the browser here again.
+func RepliesLocate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reply := new(models.Reply)
+	if err := tx.Find(reply, c.Param("rid")); err == nil {
+		if reply.Deleted || reply.TopicID.String() == c.Param("from") {
+			return c.Redirect(302, "/topics/detail/%s", reply.TopicID)
+		}
+		return c.Redirect(302, "/topics/detail/%s#%s", reply.TopicID, reply.ID)
+	}
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("rid")); err != nil {
+		return c.Error(404, err)
+	}
+	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+}
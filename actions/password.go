@@ -0,0 +1,133 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/go-saloon/saloon/mailers"
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// passwordForm holds the new password entered on the reset form.
+type passwordForm struct {
+	Password        string `form:"Password"`
+	PasswordConfirm string `form:"PasswordConfirm"`
+}
+
+// UsersForgotPasswordGet displays the form to request a password reset.
+func UsersForgotPasswordGet(c buffalo.Context) error {
+	return c.Render(200, r.HTML("users/forgot_password"))
+}
+
+// UsersForgotPasswordPost mails a password reset link to the user owning
+// the given email address.
+// The same message is displayed whether the address is known or not.
+func UsersForgotPasswordPost(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	email := strings.ToLower(strings.TrimSpace(c.Param("Email")))
+	if email == "" {
+		verrs := validate.NewErrors()
+		verrs.Add("Email", "Email can not be blank.")
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("users/forgot_password"))
+	}
+
+	usr := new(models.User)
+	err := tx.Where("email = ?", email).First(usr)
+	switch {
+	case err == nil:
+		tok, err := models.NewPasswordReset(tx, usr)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = mailers.SendPasswordReset(c, usr, tok)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	case errors.Cause(err) == sql.ErrNoRows:
+		// unknown address: do not tell.
+	default:
+		return errors.WithStack(err)
+	}
+
+	c.Flash().Add("success", "If an account matches this address, a password reset link has been sent to it.")
+	return c.Redirect(302, "/users/login")
+}
+
+// UsersResetPasswordGet displays the form to choose a new password.
+func UsersResetPasswordGet(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	_, err := models.FindPasswordReset(tx, c.Param("token"))
+	if err != nil {
+		if errors.Cause(err) == models.ErrInvalidToken {
+			c.Flash().Add("danger", "This password reset link is invalid or has expired.")
+			return c.Redirect(302, "/users/forgot-password")
+		}
+		return errors.WithStack(err)
+	}
+	c.Set("token", c.Param("token"))
+	return c.Render(200, r.HTML("users/reset_password"))
+}
+
+// UsersResetPasswordPost sets the new password of the user and logs out
+// all of the user's sessions.
+func UsersResetPasswordPost(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reset, err := models.FindPasswordReset(tx, c.Param("token"))
+	if err != nil {
+		if errors.Cause(err) == models.ErrInvalidToken {
+			c.Flash().Add("danger", "This password reset link is invalid or has expired.")
+			return c.Redirect(302, "/users/forgot-password")
+		}
+		return errors.WithStack(err)
+	}
+
+	form := new(passwordForm)
+	if err := c.Bind(form); err != nil {
+		return errors.WithStack(err)
+	}
+	verrs := validate.Validate(
+		&validators.StringIsPresent{Field: form.Password, Name: "Password"},
+		&validators.StringsMatch{Name: "Password", Field: form.Password, Field2: form.PasswordConfirm, Message: "Passwords do not match."},
+	)
+	if verrs.HasAny() {
+		c.Set("token", c.Param("token"))
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("users/reset_password"))
+	}
+
+	usr := new(models.User)
+	if err := tx.Find(usr, reset.UserID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := usr.SetPassword(form.Password); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := reset.Consume(tx); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := models.ResetLoginFailures(tx, models.UserThrottle(usr.Username)); err != nil {
+		return errors.WithStack(err)
+	}
+	// sessions opened with the old password are not valid anymore.
+	if err := models.RevokeUserSessions(tx, usr.ID, uuid.Nil); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Session().Clear()
+	c.Flash().Add("success", "Your password has been changed. You can now log in.")
+	return c.Redirect(302, "/users/login")
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+)
+
+// pollParams returns the poll described by the Poll* parameters of a
+// topic form, or nil if the form describes no poll.
+func pollParams(c buffalo.Context) (*models.Poll, *validate.Errors) {
+	verrs := validate.NewErrors()
+	poll := &models.Poll{
+		Question:  strings.TrimSpace(c.Param("PollQuestion")),
+		Options:   models.ParsePollOptions(c.Param("PollOptions")),
+		Multiple:  c.Param("PollMultiple") == "true",
+		Anonymous: c.Param("PollAnonymous") == "true",
+	}
+	if v := c.Param("PollClosesAt"); v != "" {
+		t, err := time.Parse(models.PollTimeLayout, v)
+		if err != nil {
+			verrs.Add("closes_at", "The closing time of the poll is invalid.")
+		} else {
+			poll.ClosesAt = nulls.NewTime(t)
+		}
+	}
+	if poll.Question == "" && len(poll.Options) == 0 {
+		return nil, verrs
+	}
+	return poll, verrs
+}
+
+// pollOrEmpty returns poll, or an empty poll to fill the topic forms
+// with if poll is nil.
+func pollOrEmpty(poll *models.Poll) *models.Poll {
+	if poll == nil {
+		return &models.Poll{}
+	}
+	return poll
+}
+
+// savePoll attaches the poll edit to a topic, replacing its previous
+// poll, or removes the poll of the topic if edit is nil.
+// Edits that would invalidate the votes already cast are refused.
+func savePoll(tx *pop.Connection, topic *models.Topic, edit *models.Poll) (*validate.Errors, error) {
+	poll, err := models.FindPoll(tx, topic.ID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if poll == nil {
+		if edit == nil {
+			return validate.NewErrors(), nil
+		}
+		edit.TopicID = topic.ID
+		verrs, err := tx.ValidateAndCreate(edit)
+		return verrs, errors.WithStack(err)
+	}
+
+	votes, err := poll.Votes(tx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if edit == nil {
+		verrs := validate.NewErrors()
+		if len(votes) > 0 {
+			verrs.Add("poll", "Votes were already cast: the poll can not be removed.")
+			return verrs, nil
+		}
+		return verrs, errors.WithStack(tx.Destroy(poll))
+	}
+	if verrs := poll.CheckEdit(edit, votes); verrs.HasAny() {
+		return verrs, nil
+	}
+	poll.Question = edit.Question
+	poll.Options = edit.Options
+	poll.Multiple = edit.Multiple
+	poll.Anonymous = edit.Anonymous
+	poll.ClosesAt = edit.ClosesAt
+	verrs, err := tx.ValidateAndUpdate(poll)
+	return verrs, errors.WithStack(err)
+}
+
+// setPoll makes the poll of a topic, and its results, available to
+// templates.
+func setPoll(c buffalo.Context, topic *models.Topic) error {
+	tx := c.Value("tx").(*pop.Connection)
+	poll, err := models.FindPoll(tx, topic.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("hasPoll", poll != nil)
+	if poll == nil {
+		return nil
+	}
+	votes, err := poll.Votes(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// the voters of anonymous polls are not named.
+	var uids []uuid.UUID
+	if !poll.Anonymous {
+		for _, v := range votes {
+			uids = append(uids, v.UserID)
+		}
+	}
+	names, err := usernames(tx, uids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	c.Set("poll", poll)
+	c.Set("pollResults", poll.Results(votes, names, usr.ID))
+	return nil
+}
+
+// TopicsVote records the vote of the current user in the poll of a topic.
+// The chosen options are given by the Option parameters.
+func TopicsVote(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("tid")); err != nil || topic.Deleted {
+		return c.Error(404, errors.Errorf("no topic %s", c.Param("tid")))
+	}
+	poll, err := models.FindPoll(tx, topic.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if poll == nil {
+		return c.Error(404, errors.Errorf("no poll in topic %s", topic.ID))
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !topic.AcceptsReplies() || cat.Archived {
+		c.Flash().Add("danger", "This topic does not accept votes.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if err := c.Request().ParseForm(); err != nil {
+		return c.Error(400, err)
+	}
+	var options []int
+	for _, v := range c.Request().Form["Option"] {
+		o, err := strconv.Atoi(v)
+		if err != nil {
+			return c.Error(400, errors.Errorf("invalid option %q", v))
+		}
+		options = append(options, o)
+	}
+	if err := poll.CheckChoice(options); err != nil {
+		c.Flash().Add("danger", "Invalid vote: "+err.Error()+".")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if poll.IsClosed() {
+		c.Flash().Add("danger", "This poll is closed.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if err := poll.Vote(tx, usr.ID, options); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Vote recorded.")
+	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+}
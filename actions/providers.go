@@ -0,0 +1,272 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/go-saloon/saloon/login"
+	"github.com/go-saloon/saloon/mailers"
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/pkg/errors"
+)
+
+// registerLoginProviders registers the external identity providers
+// configured in the environment.
+func registerLoginProviders() {
+	issuer := envy.Get("SALOON_OIDC_ISSUER", "")
+	if issuer == "" {
+		return
+	}
+	login.Register(login.NewOIDC(login.OIDCConfig{
+		Name:         "oidc",
+		DisplayName:  envy.Get("SALOON_OIDC_NAME", "SSO"),
+		Issuer:       issuer,
+		ClientID:     envy.Get("SALOON_OIDC_CLIENT_ID", ""),
+		ClientSecret: envy.Get("SALOON_OIDC_CLIENT_SECRET", ""),
+		RedirectURL:  envy.Get("SALOON_OIDC_REDIRECT_URL", "http://127.0.0.1:3000/users/auth/oidc/callback"),
+	}))
+}
+
+// UsersAuthStart redirects the user to the consent page of an external
+// identity provider.
+func UsersAuthStart(c buffalo.Context) error {
+	p, ok := login.Lookup(c.Param("provider"))
+	if !ok {
+		return c.Error(404, errors.Errorf("unknown login provider %q", c.Param("provider")))
+	}
+	state, err := login.NewRandom()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	verifier, err := login.NewRandom()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	url, err := p.AuthCodeURL(c, state, verifier)
+	if err != nil {
+		log.Printf("login provider %q: %+v", p.Name(), err)
+		c.Flash().Add("danger", fmt.Sprintf("Could not reach %s. Please try again later.", p.DisplayName()))
+		return c.Redirect(302, "/users/login")
+	}
+	c.Session().Set("oauth_provider", p.Name())
+	c.Session().Set("oauth_state", state)
+	c.Session().Set("oauth_verifier", verifier)
+	return c.Redirect(302, url)
+}
+
+// UsersAuthCallback completes the login with an external identity provider.
+// The external identity is linked to the current user if there is one,
+// and a new account is created on first login otherwise.
+func UsersAuthCallback(c buffalo.Context) error {
+	p, ok := login.Lookup(c.Param("provider"))
+	if !ok {
+		return c.Error(404, errors.Errorf("unknown login provider %q", c.Param("provider")))
+	}
+	sess := c.Session()
+	name, _ := sess.Get("oauth_provider").(string)
+	state, _ := sess.Get("oauth_state").(string)
+	verifier, _ := sess.Get("oauth_verifier").(string)
+	sess.Delete("oauth_provider")
+	sess.Delete("oauth_state")
+	sess.Delete("oauth_verifier")
+
+	if name != p.Name() || state == "" || c.Param("state") != state {
+		c.Flash().Add("danger", "Invalid login attempt. Please try again.")
+		return c.Redirect(302, "/users/login")
+	}
+	if c.Param("error") != "" {
+		c.Flash().Add("danger", fmt.Sprintf("%s refused the login: %s", p.DisplayName(), c.Param("error")))
+		return c.Redirect(302, "/users/login")
+	}
+
+	ident, err := p.Exchange(c, c.Param("code"), verifier)
+	if err != nil {
+		log.Printf("login provider %q: %+v", p.Name(), err)
+		c.Flash().Add("danger", fmt.Sprintf("Could not log in with %s.", p.DisplayName()))
+		return c.Redirect(302, "/users/login")
+	}
+
+	tx := c.Value("tx").(*pop.Connection)
+	link, err := models.FindUserIdentity(tx, ident.Provider, ident.Subject)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if cur, ok := c.Value("current_user").(*models.User); ok && cur != nil {
+		switch {
+		case link == nil:
+			if err := linkIdentity(tx, cur, ident); err != nil {
+				return errors.WithStack(err)
+			}
+			c.Flash().Add("success", fmt.Sprintf("Your %s account is now linked.", p.DisplayName()))
+		case link.UserID != cur.ID:
+			c.Flash().Add("danger", fmt.Sprintf("This %s account is already linked to another user.", p.DisplayName()))
+		}
+		return c.Redirect(302, "/users/settings")
+	}
+
+	usr := new(models.User)
+	if link != nil {
+		if err := tx.Find(usr, link.UserID); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		if ident.Email == "" {
+			c.Flash().Add("danger", fmt.Sprintf("Your %s account has no email address.", p.DisplayName()))
+			return c.Redirect(302, "/users/login")
+		}
+		usr, err = provisionUser(c, tx, ident)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if usr == nil {
+			c.Flash().Add("danger", fmt.Sprintf(
+				"An account already uses the email address of your %s account. "+
+					"Log in with your password, then link your %[1]s account from your settings.",
+				p.DisplayName(),
+			))
+			return c.Redirect(302, "/users/login")
+		}
+	}
+
+	if usr.TOTPEnabled {
+		startTwoFactor(c, usr)
+		return c.Redirect(302, "/users/login/two-factor")
+	}
+	if err := logIn(c, usr); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Welcome!")
+	return c.Redirect(302, "/")
+}
+
+// UsersSettingsUnlinkIdentity removes the link between the current user
+// and an external identity.
+func UsersSettingsUnlinkIdentity(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	ident := new(models.UserIdentity)
+	if err := tx.Find(ident, c.Param("iid")); err != nil {
+		return c.Error(404, err)
+	}
+	if ident.UserID != usr.ID {
+		c.Flash().Add("danger", "You are not authorized to unlink this account.")
+		return c.Redirect(302, "/users/settings")
+	}
+	if err := tx.Destroy(ident); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Account unlinked.")
+	return c.Redirect(302, "/users/settings")
+}
+
+func linkIdentity(tx *pop.Connection, usr *models.User, ident *login.Identity) error {
+	link := &models.UserIdentity{
+		UserID:   usr.ID,
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+	}
+	if ident.Email != "" {
+		link.Email = nulls.NewString(ident.Email)
+	}
+	verrs, err := tx.ValidateAndCreate(link)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return errors.New(verrs.Error())
+	}
+	return nil
+}
+
+// provisionUser creates a new account for an external identity.
+// It returns a nil user if the email address of the identity is already
+// used by another account.
+func provisionUser(c buffalo.Context, tx *pop.Connection, ident *login.Identity) (*models.User, error) {
+	email := strings.ToLower(ident.Email)
+	n, err := tx.Where("email = ?", email).Count(&models.User{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if n > 0 {
+		return nil, nil
+	}
+
+	name, err := freeUsername(tx, ident)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// the account has no usable password until the user resets it.
+	pwd, err := login.NewRandom()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	usr := &models.User{
+		Username:        name,
+		Email:           email,
+		FullName:        ident.FullName,
+		Password:        pwd,
+		PasswordConfirm: pwd,
+	}
+	usr.Avatar, err = GenAvatar(usr.Username)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := subscribeAllCategories(tx, usr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	verrs, err := usr.Create(tx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return nil, errors.New(verrs.Error())
+	}
+	if ident.EmailVerified {
+		usr.EmailVerified = true
+		if err := tx.Update(usr); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else if err := mailers.SendEmailVerification(c, usr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := linkIdentity(tx, usr, ident); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return usr, nil
+}
+
+var reUsername = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// freeUsername derives an unused username from an external identity.
+func freeUsername(tx *pop.Connection, ident *login.Identity) (string, error) {
+	base := ident.Username
+	if base == "" {
+		base = strings.SplitN(ident.Email, "@", 2)[0]
+	}
+	base = reUsername.ReplaceAllString(strings.ToLower(base), "")
+	if base == "" {
+		base = "user"
+	}
+	name := base
+	for i := 2; ; i++ {
+		n, err := tx.Where("username = ?", name).Count(&models.User{})
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if n == 0 {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// setReactions makes the reactions to a topic and its replies available
+// to templates, keyed by post ID.
+func setReactions(c buffalo.Context, topic *models.Topic) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reactions := models.Reactions{}
+	if err := tx.Where("topic_id = ?", topic.ID).All(&reactions); err != nil {
+		return errors.WithStack(err)
+	}
+	uids := make([]uuid.UUID, 0, len(reactions))
+	for _, r := range reactions {
+		uids = append(uids, r.UserID)
+	}
+	names, err := usernames(tx, uids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	forum := c.Value("forum").(*models.Forum)
+	usr := c.Value("current_user").(*models.User)
+	sums := reactions.Summarize(forum.ReactionSet(), names, usr.ID)
+	// templates can not range over missing entries.
+	if _, ok := sums[topic.ID.String()]; !ok {
+		sums[topic.ID.String()] = nil
+	}
+	for _, reply := range topic.Replies {
+		if _, ok := sums[reply.ID.String()]; !ok {
+			sums[reply.ID.String()] = nil
+		}
+	}
+	c.Set("reactions", sums)
+	c.Set("reactionSet", forum.ReactionSet())
+	return nil
+}
+
+// toggleReaction toggles the reaction of the current user to a post.
+func toggleReaction(c buffalo.Context, topic *models.Topic, post uuid.UUID) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if cat.Archived {
+		c.Flash().Add("danger", "This category is archived.")
+		return nil
+	}
+	usr := c.Value("current_user").(*models.User)
+	if topic.Locked && !usr.Moderates(cat) {
+		c.Flash().Add("danger", "This topic is locked.")
+		return nil
+	}
+	emoji := c.Param("Emoji")
+	known := false
+	for _, r := range c.Value("forum").(*models.Forum).ReactionSet() {
+		known = known || r == emoji
+	}
+	if !known {
+		// reactions that are no longer offered may only be removed.
+		n, err := tx.Where("post_id = ? AND user_id = ? AND emoji = ?", post, usr.ID, emoji).Count(&models.Reaction{})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if n == 0 {
+			return c.Error(400, errors.Errorf("invalid reaction %q", emoji))
+		}
+	}
+	_, err = models.ToggleReaction(tx, topic.ID, post, usr.ID, emoji)
+	return errors.WithStack(err)
+}
+
+// TopicsReact toggles a reaction of the current user to a topic.
+func TopicsReact(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("tid")); err != nil || topic.Deleted {
+		return c.Error(404, errors.Errorf("no topic %s", c.Param("tid")))
+	}
+	if err := toggleReaction(c, topic, topic.ID); err != nil {
+		return err
+	}
+	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+}
+
+// RepliesReact toggles a reaction of the current user to a reply.
+func RepliesReact(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reply := new(models.Reply)
+	if err := tx.Find(reply, c.Param("rid")); err != nil || reply.Deleted {
+		return c.Error(404, errors.Errorf("no reply %s", c.Param("rid")))
+	}
+	topic := new(models.Topic)
+	if err := tx.Find(topic, reply.TopicID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := toggleReaction(c, topic, reply.ID); err != nil {
+		return err
+	}
+	return c.Redirect(302, "/topics/detail/%s#%s", topic.ID, reply.ID)
+}
+
+// UsersSettingsReactions sets the reactions users may add to posts.
+func UsersSettingsReactions(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	forum := c.Value("forum").(*models.Forum)
+	forum.Reactions = models.ParseReactions(c.Param("Reactions"))
+	if err := tx.Update(forum); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Redirect(302, "/users/settings")
+}
@@ -10,11 +10,16 @@ import (
 	"fmt"
 	"html/template"
 	"math"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/go-saloon/saloon/models"
 	"github.com/gobuffalo/buffalo/render"
 	"github.com/gobuffalo/packr"
 	"github.com/gobuffalo/plush"
+	"github.com/gobuffalo/uuid"
 	"github.com/pkg/errors"
 	"github.com/shurcooL/github_flavored_markdown"
 )
@@ -39,6 +44,13 @@ func init() {
 				return fmt.Sprintf("%.2f%%", f*100)
 			},
 			"markdown": markdownHelper,
+			"tagURL":   tagURL,
+			"maxAttachments": func() int {
+				return models.MaxAttachments
+			},
+			"maxAttachmentSize": func() string {
+				return models.FormatSize(models.MaxAttachmentSize)
+			},
 		},
 	})
 }
@@ -66,6 +78,11 @@ func timeSince(created time.Time, ctx plush.HelperContext) string {
 	return fmt.Sprintf("%ds", int(delta.Seconds()))
 }
 
+// tagURL returns the URL of the page listing the topics tagged with tag.
+func tagURL(tag string) string {
+	return "/tags/" + url.PathEscape(tag)
+}
+
 func markdownHelper(body string, help plush.HelperContext) (template.HTML, error) {
 	var err error
 	if help.HasBlock() {
@@ -78,7 +95,137 @@ func markdownHelper(body string, help plush.HelperContext) (template.HTML, error
 	return markdown(body)
 }
 
+// quote blocks hold the text of another post, with its author and location:
+//
+//	[quote author="bob" topic="<topic-id>" post="<reply-id>"]
+//	text
+//	[/quote]
+var (
+	quoteOpen  = regexp.MustCompile(`^\[quote((?:\s+\w+="[^"]*")*)\]\s*$`)
+	quoteClose = regexp.MustCompile(`^\[/quote\]\s*$`)
+	quoteAttr  = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// quoteBlock returns a quote block of the given text.
+func quoteBlock(author string, topic, post uuid.UUID, text string) string {
+	o := new(bytes.Buffer)
+	fmt.Fprintf(o, `[quote author="%s" topic="%s"`, strings.Replace(author, `"`, "", -1), topic)
+	if post != uuid.Nil {
+		fmt.Fprintf(o, ` post="%s"`, post)
+	}
+	fmt.Fprintf(o, "]\n%s\n[/quote]\n", strings.TrimSpace(text))
+	return o.String()
+}
+
+// markdown renders a post, including its quote blocks, to HTML.
 func markdown(body string) (template.HTML, error) {
+	out := new(bytes.Buffer)
+	for _, part := range splitQuotes(body) {
+		if part.attrs == nil {
+			txt, err := markdownText(part.text)
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			out.WriteString(string(txt))
+			continue
+		}
+		txt, err := markdown(part.text)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		out.WriteString("<blockquote class=\"blockquote border-left pl-3\">\n")
+		out.WriteString(string(txt))
+		if author := part.attrs["author"]; author != "" {
+			name := template.HTMLEscapeString(author)
+			topic, err1 := uuid.FromString(part.attrs["topic"])
+			post, err2 := uuid.FromString(part.attrs["post"])
+			switch {
+			case err1 == nil && err2 == nil:
+				fmt.Fprintf(out, "<footer class=\"blockquote-footer\"><a href=\"/topics/detail/%s#%s\">%s</a></footer>\n", topic, post, name)
+			case err1 == nil:
+				fmt.Fprintf(out, "<footer class=\"blockquote-footer\"><a href=\"/topics/detail/%s\">%s</a></footer>\n", topic, name)
+			default:
+				fmt.Fprintf(out, "<footer class=\"blockquote-footer\">%s</footer>\n", name)
+			}
+		}
+		out.WriteString("</blockquote>\n")
+	}
+	return template.HTML(out.Bytes()), nil
+}
+
+// quotePart is a part of a post: either plain text, or the content of a
+// quote block with its attributes.
+type quotePart struct {
+	text  string
+	attrs map[string]string
+}
+
+// splitQuotes splits a post into plain text and quote blocks.
+// Quote blocks may be nested, and are ignored inside code blocks.
+// Unterminated quote blocks are left as plain text.
+func splitQuotes(body string) []quotePart {
+	var (
+		parts []quotePart
+		text  []string // plain text of the current part
+		quote []string // lines of the current quote block, including its opening line
+		depth = 0      // nesting depth of quote blocks
+		code  = false  // whether we are inside a code block
+	)
+	flush := func() {
+		if len(text) > 0 {
+			parts = append(parts, quotePart{text: strings.Join(text, "\n")})
+			text = nil
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		switch {
+		case strings.HasPrefix(line, "```"):
+			code = !code
+		case code:
+		case quoteOpen.MatchString(line):
+			depth++
+			if depth == 1 {
+				quote = []string{line}
+				continue
+			}
+		case depth > 0 && quoteClose.MatchString(line):
+			depth--
+			if depth == 0 {
+				attrs := make(map[string]string)
+				for _, m := range quoteAttr.FindAllStringSubmatch(quoteOpen.FindStringSubmatch(quote[0])[1], -1) {
+					attrs[m[1]] = m[2]
+				}
+				flush()
+				parts = append(parts, quotePart{text: strings.Join(quote[1:], "\n"), attrs: attrs})
+				quote = nil
+				continue
+			}
+		}
+		if depth > 0 {
+			quote = append(quote, line)
+			continue
+		}
+		text = append(text, line)
+	}
+	text = append(text, quote...)
+	flush()
+	return parts
+}
+
+// linkMentions turns the @username mentions of a text into links to the
+// profiles of the users.
+func linkMentions(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = models.ReplaceMentions(line, func(name string) string {
+			return fmt.Sprintf("[@%[1]s](/users/show?username=%[1]s)", name)
+		})
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownText renders text without quote blocks to HTML.
+func markdownText(body string) (template.HTML, error) {
 	type segment struct {
 		code bool
 		data []byte
@@ -140,7 +287,7 @@ func markdown(body string) (template.HTML, error) {
 		case true:
 			data = blk.data
 		case false:
-			data = []byte(template.HTMLEscapeString(string(blk.data)))
+			data = []byte(linkMentions(template.HTMLEscapeString(string(blk.data))))
 		}
 		_, err := out.Write(github_flavored_markdown.Markdown(data))
 		if err != nil {
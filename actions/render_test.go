@@ -4,7 +4,12 @@
 
 package actions
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/uuid"
+)
 
 func TestMarkdown(t *testing.T) {
 	for _, tc := range []struct {
@@ -50,3 +55,85 @@ func TestMarkdown(t *testing.T) {
 		})
 	}
 }
+
+func TestMarkdownQuote(t *testing.T) {
+	topic := uuid.Must(uuid.NewV4())
+	post := uuid.Must(uuid.NewV4())
+	for _, tc := range []struct {
+		name string
+		data string
+		want []string
+		not  []string
+	}{
+		{
+			name: "reply",
+			data: quoteBlock("bob", topic, post, "quoted\n") + "\nanswer\n",
+			want: []string{
+				"<blockquote",
+				"<p>quoted</p>",
+				`<footer class="blockquote-footer"><a href="/topics/detail/` + topic.String() + "#" + post.String() + `">bob</a></footer>`,
+				"<p>answer</p>",
+			},
+			not: []string{"[quote", "[/quote]"},
+		},
+		{
+			name: "topic",
+			data: quoteBlock("bob", topic, uuid.Nil, "quoted"),
+			want: []string{`<a href="/topics/detail/` + topic.String() + `">bob</a>`},
+		},
+		{
+			name: "nested",
+			data: "[quote author=\"a\"]\n[quote author=\"b\"]\ninner\n[/quote]\nouter\n[/quote]\n",
+			want: []string{"<p>inner</p>", "<footer class=\"blockquote-footer\">b</footer>", "<p>outer</p>"},
+		},
+		{
+			name: "escaped-author",
+			data: "[quote author=\"<b>\" topic=\"x\"]\ntext\n[/quote]\n",
+			want: []string{"<footer class=\"blockquote-footer\">&lt;b&gt;</footer>"},
+		},
+		{
+			name: "in-code-block",
+			data: "```\n[quote author=\"a\"]\ntext\n[/quote]\n```\n",
+			want: []string{"[quote author="},
+			not:  []string{"<blockquote"},
+		},
+		{
+			name: "unterminated",
+			data: "[quote author=\"a\"]\ntext\n",
+			want: []string{"[quote author=", "text"},
+			not:  []string{"<blockquote"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			txt, err := markdown(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(string(txt), want) {
+					t.Errorf("missing %q in:\n%s", want, txt)
+				}
+			}
+			for _, not := range tc.not {
+				if strings.Contains(string(txt), not) {
+					t.Errorf("unexpected %q in:\n%s", not, txt)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownMention(t *testing.T) {
+	txt, err := markdown("hi @bob, `@carol`\n```\n@dave\n```\nmail eve@example.com\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(txt), `href="/users/show?username=bob"`) {
+		t.Errorf("missing link to bob in:\n%s", txt)
+	}
+	for _, name := range []string{"carol", "dave", "example.com"} {
+		if strings.Contains(string(txt), "username="+name) {
+			t.Errorf("unexpected link to %s in:\n%s", name, txt)
+		}
+	}
+}
@@ -5,9 +5,14 @@
 package actions
 
 import (
+	"strings"
+
 	"github.com/go-saloon/saloon/models"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
 	"github.com/pkg/errors"
 )
 
@@ -18,54 +23,185 @@ func RepliesCreateGet(c buffalo.Context) error {
 	if err := tx.Find(topic, c.Param("tid")); err != nil {
 		return c.Error(404, err)
 	}
+	if topic.Locked {
+		c.Flash().Add("danger", "This topic is locked: no new replies can be posted.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if topic.Closed {
+		c.Flash().Add("danger", "This topic is closed: no new replies can be posted.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if cat.Archived {
+		c.Flash().Add("danger", "This category is archived: no new replies can be posted.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	parent, err := parentReply(c, topic)
+	if err != nil {
+		return err
+	}
+	c.Set("parent", parent)
 	c.Set("reply", reply)
 	c.Set("topic", topic)
 	reply.TopicID = topic.ID
 	reply.Topic = topic
 	reply.Author = c.Value("current_user").(*models.User)
+	draft, err := restoreDraft(c, models.ReplyDraftContext(topic.ID))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if draft != nil {
+		reply.Content = draft.Content
+	}
+	if qid := c.Param("quote"); qid != "" {
+		quote, err := quotePost(c, topic, qid, c.Param("selection"))
+		if err != nil {
+			return err
+		}
+		if reply.Content != "" {
+			reply.Content += "\n\n"
+		}
+		reply.Content += quote + "\n"
+	}
 	return c.Render(200, r.HTML("replies/create.html"))
 }
 
-func RepliesCreatePost(c buffalo.Context) error {
+// quotePost returns a quote block of the topic, or of one of its replies,
+// designated by qid.
+// Only the selected text is quoted, if any.
+func quotePost(c buffalo.Context, topic *models.Topic, qid, selection string) (string, error) {
 	tx := c.Value("tx").(*pop.Connection)
-	reply := new(models.Reply)
-	user := c.Value("current_user").(*models.User)
-	if err := c.Bind(reply); err != nil {
+	var (
+		author  uuid.UUID
+		post    uuid.UUID
+		content string
+	)
+	switch qid {
+	case topic.ID.String():
+		author, content = topic.AuthorID, topic.Content
+	default:
+		reply, err := loadReply(c, qid)
+		if err != nil {
+			return "", err
+		}
+		if reply.TopicID != topic.ID || reply.Deleted {
+			return "", c.Error(404, errors.Errorf("no reply %s in topic %s", qid, topic.ID))
+		}
+		author, post, content = reply.AuthorID, reply.ID, reply.Content
+	}
+	usr := new(models.User)
+	if err := tx.Find(usr, author); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if strings.TrimSpace(selection) != "" {
+		content = selection
+	}
+	return quoteBlock(usr.Username, topic.ID, post, content), nil
+}
+
+// parentReply returns the reply designated by the rid parameter, that a
+// new reply answers, or nil if there is none.
+func parentReply(c buffalo.Context, topic *models.Topic) (*models.Reply, error) {
+	rid := c.Param("rid")
+	if rid == "" {
+		return nil, nil
+	}
+	parent, err := loadReply(c, rid)
+	if err != nil {
+		return nil, err
+	}
+	if parent.TopicID != topic.ID || parent.Deleted {
+		return nil, c.Error(404, errors.Errorf("no reply %s in topic %s", rid, topic.ID))
+	}
+	return parent, nil
+}
+
+func RepliesCreatePost(c buffalo.Context) error {
+	form := new(replyForm)
+	if err := c.Bind(form); err != nil {
 		return errors.WithStack(err)
 	}
 	topic, err := loadTopic(c, c.Param("tid"))
 	if err != nil {
 		return c.Error(404, err)
 	}
-	topic.AddSubscriber(user.ID)
+	if topic.Locked {
+		c.Flash().Add("danger", "This topic is locked: no new replies can be posted.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if topic.Closed {
+		c.Flash().Add("danger", "This topic is closed: no new replies can be posted.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if topic.Category.Archived {
+		c.Flash().Add("danger", "This category is archived: no new replies can be posted.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	parent, err := parentReply(c, topic)
+	if err != nil {
+		return err
+	}
 	c.Set("topic", topic)
-	reply.AuthorID = user.ID
-	reply.Author = user
-	reply.TopicID = topic.ID
-	reply.Topic = topic
+	c.Set("parent", parent)
+	reply := &models.Reply{Content: form.Content}
 
-	verrs, err := tx.ValidateAndCreate(reply)
+	uploads, verrs, err := attachmentParams(c, uuid.Nil)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-
-	if err := tx.Update(topic); err != nil {
-		return errors.WithStack(err)
+	if !verrs.HasAny() {
+		verrs, err = createReply(c, topic, reply, parent, uploads)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 	}
-
 	if verrs.HasAny() {
 		c.Set("reply", reply)
 		c.Set("errors", verrs.Errors)
 		return c.Render(422, r.HTML("replies/create"))
 	}
+
 	c.Flash().Add("success", "New reply added successfully.")
+	return c.Redirect(302, "/topics/detail/%s#%s", topic.ID, reply.ID)
+}
 
-	err = newReplyNotify(c, topic, reply)
-	if err != nil {
-		return errors.WithStack(err)
+// createReply adds a reply to a topic on behalf of the current user, in
+// answer to parent if it is not nil, with the uploaded files attached to
+// it. Web and API posts both go through it.
+// The author is subscribed to the topic, their draft is deleted and the
+// subscribers of the topic are notified.
+func createReply(c buffalo.Context, topic *models.Topic, reply, parent *models.Reply, uploads []upload) (*validate.Errors, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	reply.Author = usr
+	reply.AuthorID = usr.ID
+	reply.Topic = topic
+	reply.TopicID = topic.ID
+	reply.ParentReplyID = nulls.UUID{}
+	if parent != nil {
+		reply.ParentReplyID = nulls.NewUUID(parent.ID)
 	}
-
-	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	verrs, err := tx.ValidateAndCreate(reply)
+	if err != nil || verrs.HasAny() {
+		return verrs, errors.WithStack(err)
+	}
+	topic.AddSubscriber(usr.ID)
+	if err := tx.Update(topic); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := saveAttachments(c, topic.ID, reply.ID, uploads); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := models.DeleteDraft(tx, usr.ID, models.ReplyDraftContext(topic.ID)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := newReplyNotify(c, topic, reply); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return verrs, nil
 }
 
 func RepliesEditGet(c buffalo.Context) error {
@@ -74,21 +210,85 @@ func RepliesEditGet(c buffalo.Context) error {
 	if err := tx.Find(reply, c.Param("rid")); err != nil {
 		return c.Error(404, err)
 	}
+	cat, err := replyCategory(tx, reply)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if usr := c.Value("current_user").(*models.User); reply.Event != "" || !usr.CanEditIn(reply.AuthorID, reply.Topic, cat) {
+		c.Flash().Add("danger", "You are not authorized to edit this reply")
+		return c.Redirect(302, "/topics/detail/%s", reply.TopicID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, reply.TopicID)
+	}
+	atts, err := models.PostAttachments(tx, reply.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 	c.Set("reply", reply)
+	c.Set("postAttachments", atts)
 	return c.Render(200, r.HTML("replies/edit"))
 }
 
+// replyForm holds the fields of a reply that its author may set.
+type replyForm struct {
+	Content string `form:"Content"`
+}
+
 func RepliesEditPost(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 	reply := new(models.Reply)
 	if err := tx.Find(reply, c.Param("rid")); err != nil {
 		return errors.WithStack(err)
 	}
-	if err := c.Bind(reply); err != nil {
+	cat, err := replyCategory(tx, reply)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if reply.Event != "" || !usr.CanEditIn(reply.AuthorID, reply.Topic, cat) {
+		c.Flash().Add("danger", "You are not authorized to edit this reply")
+		return c.Redirect(302, "/topics/detail/%s", reply.TopicID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, reply.TopicID)
+	}
+	orig := reply.Revision(reply.AuthorID, "")
+	orig.CreatedAt = reply.CreatedAt
+	form := new(replyForm)
+	if err := c.Bind(form); err != nil {
+		return errors.WithStack(err)
+	}
+	reply.Content = form.Content
+	uploads, verrs, err := attachmentParams(c, reply.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		atts, err := models.PostAttachments(tx, reply.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("reply", reply)
+		c.Set("postAttachments", atts)
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("replies/edit"))
+	}
+	if err := removeAttachments(c, reply.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := saveAttachments(c, reply.TopicID, reply.ID, uploads); err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := tx.Update(reply); err != nil {
+	if err := saveEdit(tx, reply, orig, reply.Revision(usr.ID, c.Param("Reason"))); err != nil {
+		return errors.WithStack(err)
+	}
+	topic := new(models.Topic)
+	if err := tx.Find(topic, reply.TopicID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := mentionNotify(c, topic, reply.ID, usr, reply.Content, orig.Content, nil); err != nil {
 		return errors.WithStack(err)
 	}
 	c.Flash().Add("success", "Reply edited successfully.")
@@ -100,16 +300,26 @@ func RepliesDelete(c buffalo.Context) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	tx := c.Value("tx").(*pop.Connection)
+	cat, err := findCategory(tx, reply.Topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 	usr := c.Value("current_user").(*models.User)
-	if !usr.Admin && usr.ID != reply.AuthorID {
+	if !usr.CanDelete(reply.AuthorID, cat) {
 		c.Flash().Add("danger", "You are not authorized to delete this reply")
 		return c.Redirect(302, "/topics/detail/%s", reply.TopicID)
 	}
-	tx := c.Value("tx").(*pop.Connection)
+	if cat.Archived {
+		return refuseArchived(c, reply.TopicID)
+	}
 	reply.Deleted = true
 	if err := tx.Update(reply); err != nil {
 		return errors.WithStack(err)
 	}
+	if err := models.ClearSolution(tx, reply.ID); err != nil {
+		return errors.WithStack(err)
+	}
 	c.Flash().Add("success", "Reply deleted successfuly.")
 	return c.Redirect(302, "/topics/detail/%s", reply.TopicID)
 }
@@ -129,12 +339,20 @@ func RepliesDetail(c buffalo.Context) error {
 	return c.Render(200, r.HTML("replies/detail"))
 }
 
+// replyCategory retrieves the category of the topic of a reply, and sets
+// the topic of the reply.
+func replyCategory(tx *pop.Connection, reply *models.Reply) (*models.Category, error) {
+	topic := new(models.Topic)
+	if err := tx.Find(topic, reply.TopicID); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	reply.Topic = topic
+	return findCategory(tx, topic.CategoryID)
+}
+
 func loadReply(c buffalo.Context, id string) (*models.Reply, error) {
 	tx := c.Value("tx").(*pop.Connection)
 	reply := &models.Reply{}
-	if err := c.Bind(reply); err != nil {
-		return nil, errors.WithStack(err)
-	}
 	if err := tx.Find(reply, id); err != nil {
 		return nil, c.Error(404, err)
 	}
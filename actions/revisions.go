@@ -0,0 +1,197 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// saveEdit saves an edited topic or reply.
+// When the post changed, the new version rev is recorded in its history,
+// orig being its version before the edit.
+func saveEdit(tx *pop.Connection, post interface{}, orig, rev *models.Revision) error {
+	if rev.Title != orig.Title || rev.Content != orig.Content {
+		now := nulls.NewTime(time.Now().UTC())
+		switch post := post.(type) {
+		case *models.Topic:
+			post.EditedAt = now
+		case *models.Reply:
+			post.EditedAt = now
+		}
+		if err := models.AddRevision(tx, orig, rev); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(tx.Update(post))
+}
+
+// renderRevisions displays the history of a post.
+func renderRevisions(c buffalo.Context, revs models.Revisions, back, rollback string, canRollback bool) error {
+	tx := c.Value("tx").(*pop.Connection)
+	ids := make([]uuid.UUID, 0, len(revs))
+	for _, rev := range revs {
+		ids = append(ids, rev.EditorID)
+	}
+	names, err := usernames(tx, ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	editors := make(map[string]string, len(names))
+	for id, name := range names {
+		editors[id.String()] = name
+	}
+	c.Set("revisions", revs.Diffs())
+	c.Set("editors", editors)
+	c.Set("back", back)
+	c.Set("rollback", rollback)
+	c.Set("canRollback", canRollback)
+	return c.Render(200, r.HTML("revisions/index"))
+}
+
+// TopicsRevisions displays the edit history of a topic.
+func TopicsRevisions(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("tid")); err != nil || topic.Deleted {
+		return c.Error(404, errors.Errorf("no topic %s", c.Param("tid")))
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	revs, err := models.FindRevisions(tx, topic.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	c.Set("title", topic.Title)
+	return renderRevisions(c, revs,
+		fmt.Sprintf("/topics/detail/%s", topic.ID),
+		fmt.Sprintf("/topics/revisions/%s/rollback", topic.ID),
+		usr.Moderates(cat) && !cat.Archived,
+	)
+}
+
+// RepliesRevisions displays the edit history of a reply.
+func RepliesRevisions(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reply := new(models.Reply)
+	if err := tx.Find(reply, c.Param("rid")); err != nil || reply.Deleted {
+		return c.Error(404, errors.Errorf("no reply %s", c.Param("rid")))
+	}
+	topic := new(models.Topic)
+	if err := tx.Find(topic, reply.TopicID); err != nil {
+		return errors.WithStack(err)
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	revs, err := models.FindRevisions(tx, reply.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	c.Set("title", topic.Title)
+	return renderRevisions(c, revs,
+		fmt.Sprintf("/topics/detail/%s#%s", topic.ID, reply.ID),
+		fmt.Sprintf("/replies/revisions/%s/rollback", reply.ID),
+		usr.Moderates(cat) && !cat.Archived,
+	)
+}
+
+// findRevision returns a revision of a post, and its number in the
+// history of the post.
+func findRevision(tx *pop.Connection, post *models.Revision, revid string) (*models.Revision, int, error) {
+	revs, err := models.FindRevisions(tx, post.PostID)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	for i, rev := range revs {
+		if rev.ID.String() == revid {
+			return &rev, i + 1, nil
+		}
+	}
+	return nil, 0, errors.Errorf("no revision %s", revid)
+}
+
+// TopicsRevisionsRollback restores a previous version of a topic.
+// Only moderators may roll back topics.
+func TopicsRevisionsRollback(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("tid")); err != nil {
+		return c.Error(404, err)
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if !usr.Moderates(cat) {
+		c.Flash().Add("danger", "You are not authorized to roll back this topic")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, topic.ID)
+	}
+	orig := topic.Revision(topic.AuthorID, "")
+	orig.CreatedAt = topic.CreatedAt
+	rev, n, err := findRevision(tx, orig, c.Param("revid"))
+	if err != nil {
+		return c.Error(404, err)
+	}
+	topic.Title = rev.Title
+	topic.Content = rev.Content
+	reason := fmt.Sprintf("Rolled back to revision %d", n)
+	if err := saveEdit(tx, topic, orig, topic.Revision(usr.ID, reason)); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", fmt.Sprintf("Topic rolled back to revision %d.", n))
+	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+}
+
+// RepliesRevisionsRollback restores a previous version of a reply.
+// Only moderators may roll back replies.
+func RepliesRevisionsRollback(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	reply := new(models.Reply)
+	if err := tx.Find(reply, c.Param("rid")); err != nil {
+		return c.Error(404, err)
+	}
+	cat, err := replyCategory(tx, reply)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if !usr.Moderates(cat) {
+		c.Flash().Add("danger", "You are not authorized to roll back this reply")
+		return c.Redirect(302, "/topics/detail/%s#%s", reply.TopicID, reply.ID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, reply.TopicID)
+	}
+	orig := reply.Revision(reply.AuthorID, "")
+	orig.CreatedAt = reply.CreatedAt
+	rev, n, err := findRevision(tx, orig, c.Param("revid"))
+	if err != nil {
+		return c.Error(404, err)
+	}
+	reply.Content = rev.Content
+	reason := fmt.Sprintf("Rolled back to revision %d", n)
+	if err := saveEdit(tx, reply, orig, reply.Revision(usr.ID, reason)); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", fmt.Sprintf("Reply rolled back to revision %d.", n))
+	return c.Redirect(302, "/topics/detail/%s#%s", reply.TopicID, reply.ID)
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"sort"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/slices"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// UsersSettingsRoles lists the roles of the forum and the roles assigned
+// to each user.
+func UsersSettingsRoles(c buffalo.Context) error {
+	return renderRoles(c, 200, &models.Role{})
+}
+
+func renderRoles(c buffalo.Context, status int, role *models.Role) error {
+	tx := c.Value("tx").(*pop.Connection)
+	roles := new(models.Roles)
+	if err := tx.All(roles); err != nil {
+		return errors.WithStack(err)
+	}
+	sort.Sort(roles)
+	users := new(models.Users)
+	if err := tx.All(users); err != nil {
+		return errors.WithStack(err)
+	}
+	sort.Sort(users)
+	c.Set("roles", roles)
+	c.Set("users", users)
+	c.Set("role", role)
+	c.Set("permissions", models.Permissions)
+	return c.Render(status, r.HTML("users/roles"))
+}
+
+// formPermissions returns the permissions checked in the submitted form.
+func formPermissions(c buffalo.Context) (slices.String, error) {
+	req := c.Request()
+	if err := req.ParseForm(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return slices.String(req.Form["Permissions"]), nil
+}
+
+// UsersSettingsRolesCreate creates a new role.
+func UsersSettingsRolesCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	perms, err := formPermissions(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	role := &models.Role{Name: c.Param("Name"), Permissions: perms}
+	verrs, err := tx.ValidateAndCreate(role)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		c.Set("errors", verrs.Errors)
+		return renderRoles(c, 422, role)
+	}
+	c.Flash().Add("success", "Role created.")
+	return c.Redirect(302, "/users/settings/roles")
+}
+
+// UsersSettingsRolesUpdate replaces the permissions of a role.
+// Users can not modify the roles they hold, so that they can not lock
+// themselves out.
+func UsersSettingsRolesUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	role := new(models.Role)
+	if err := tx.Find(role, c.Param("roleid")); err != nil {
+		return c.Error(404, err)
+	}
+	if usr.HasRole(role.ID) {
+		c.Flash().Add("danger", "You can not modify a role you hold.")
+		return c.Redirect(302, "/users/settings/roles")
+	}
+	perms, err := formPermissions(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	role.Permissions = perms
+	verrs, err := tx.ValidateAndUpdate(role)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		c.Set("errors", verrs.Errors)
+		return renderRoles(c, 422, &models.Role{})
+	}
+	c.Flash().Add("success", "Role updated.")
+	return c.Redirect(302, "/users/settings/roles")
+}
+
+// UsersSettingsRolesDelete deletes a role and removes it from all users.
+func UsersSettingsRolesDelete(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	role := new(models.Role)
+	if err := tx.Find(role, c.Param("roleid")); err != nil {
+		return c.Error(404, err)
+	}
+	if usr.HasRole(role.ID) {
+		c.Flash().Add("danger", "You can not delete a role you hold.")
+		return c.Redirect(302, "/users/settings/roles")
+	}
+	err := tx.RawQuery("UPDATE users SET roles = array_remove(roles, ?)", role.ID.String()).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := tx.Destroy(role); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Role deleted.")
+	return c.Redirect(302, "/users/settings/roles")
+}
+
+// UsersSettingsUserRoles replaces the roles assigned to a user.
+func UsersSettingsUserRoles(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	cur := c.Value("current_user").(*models.User)
+	usr := new(models.User)
+	if err := tx.Find(usr, c.Param("uid")); err != nil {
+		return c.Error(404, err)
+	}
+	if usr.ID == cur.ID {
+		c.Flash().Add("danger", "You can not modify your own roles.")
+		return c.Redirect(302, "/users/settings/roles")
+	}
+	req := c.Request()
+	if err := req.ParseForm(); err != nil {
+		return errors.WithStack(err)
+	}
+	roles := make(slices.UUID, 0, len(req.Form["Roles"]))
+	for _, v := range req.Form["Roles"] {
+		id, err := uuid.FromString(v)
+		if err != nil {
+			return c.Error(400, err)
+		}
+		if err := tx.Find(&models.Role{}, id); err != nil {
+			return c.Error(400, err)
+		}
+		roles = append(roles, id)
+	}
+	usr.Roles = roles
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Roles updated.")
+	return c.Redirect(302, "/users/settings/roles#%s", usr.ID)
+}
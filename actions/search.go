@@ -75,8 +75,19 @@ func indexDB() error {
 		if err := tx.All(topics); err != nil {
 			return errors.WithStack(err)
 		}
+		// topics are indexed along with their tags;
+		// unlisted and merged topics, and their replies, are kept out of
+		// the index.
+		unlisted := make(map[uuid.UUID]bool)
 		for _, t := range *topics {
-			err := index.Index("topics/detail/"+t.ID.String(), t)
+			id := topicIndexID(t.ID)
+			var err error
+			if !indexed(t) {
+				unlisted[t.ID] = true
+				err = index.Delete(id)
+			} else {
+				err = index.Index(id, t)
+			}
 			if err != nil {
 				return errors.WithStack(err)
 			}
@@ -87,7 +98,16 @@ func indexDB() error {
 			return errors.WithStack(err)
 		}
 		for _, r := range *replies {
-			err := index.Index(fmt.Sprintf("topics/detail/%s#%s", r.TopicID, r.ID), r)
+			if r.Event != "" {
+				continue
+			}
+			id := replyIndexID(r.TopicID, r.ID)
+			var err error
+			if unlisted[r.TopicID] {
+				err = index.Delete(id)
+			} else {
+				err = index.Index(id, r)
+			}
 			if err != nil {
 				return errors.WithStack(err)
 			}
@@ -96,6 +116,55 @@ func indexDB() error {
 	})
 }
 
+// topicIndexID returns the ID of a topic in the search index.
+func topicIndexID(tid uuid.UUID) string { return "topics/detail/" + tid.String() }
+
+// replyIndexID returns the ID of a reply in the search index.
+func replyIndexID(tid, rid uuid.UUID) string { return fmt.Sprintf("topics/detail/%s#%s", tid, rid) }
+
+// indexed reports whether a topic belongs in the search index.
+func indexed(t models.Topic) bool { return !t.Unlisted && !t.MergedInto.Valid }
+
+// reindexTopic updates the search index entries of a topic and of its
+// replies, once they moved.
+// moved are the posts that left the topic, whose entries are removed.
+func reindexTopic(tx *pop.Connection, tid uuid.UUID, moved ...uuid.UUID) error {
+	topic := new(models.Topic)
+	if err := tx.Find(topic, tid); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, post := range moved {
+		if err := index.Delete(replyIndexID(tid, post)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	replies := models.Replies{}
+	if err := tx.Where("topic_id = ?", tid).All(&replies); err != nil {
+		return errors.WithStack(err)
+	}
+	if !indexed(*topic) {
+		// the replies of unlisted topics can not be found either.
+		for _, r := range replies {
+			if err := index.Delete(replyIndexID(tid, r.ID)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return errors.WithStack(index.Delete(topicIndexID(tid)))
+	}
+	if err := index.Index(topicIndexID(tid), topic); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, r := range replies {
+		if r.Event != "" {
+			continue
+		}
+		if err := index.Index(replyIndexID(tid, r.ID), r); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 func Search(c buffalo.Context) error {
 	if c.Param("query") == "" {
 		return c.Render(200, r.HTML("search"))
@@ -0,0 +1,51 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// UsersSettingsSessionsRevoke revokes one of the sessions of the current user.
+func UsersSettingsSessionsRevoke(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	sid, err := uuid.FromString(c.Param("sid"))
+	if err != nil {
+		return c.Error(404, err)
+	}
+	sess, err := models.FindUserSession(tx, sid, usr.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if sess == nil {
+		return c.Error(404, errors.Errorf("no session %v", sid))
+	}
+	if err := tx.Destroy(sess); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Session revoked.")
+	return c.Redirect(302, "/users/settings")
+}
+
+// UsersSettingsSessionsRevokeOthers revokes all the sessions of the current
+// user but the current one.
+func UsersSettingsSessionsRevokeOthers(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	cur, ok := c.Value("current_session").(*models.UserSession)
+	if !ok {
+		return c.Redirect(302, "/users/settings")
+	}
+	if err := models.RevokeUserSessions(tx, usr.ID, cur.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "All your other sessions have been revoked.")
+	return c.Redirect(302, "/users/settings")
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// TagsShow lists the topics tagged with a tag, most recent first, a page
+// at a time.
+func TagsShow(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	tag := models.NormalizeTag(c.Param("tag"))
+	if tag == "" {
+		return c.Error(404, errors.Errorf("no tag %q", c.Param("tag")))
+	}
+	usr := c.Value("current_user").(*models.User)
+	q := tx.PaginateFromParams(c.Params()).Where("? = ANY(tags) AND deleted = ?", tag, false)
+	// unlisted topics are only listed for moderators.
+	if !usr.Can(models.PermModerate) {
+		mods, err := moderatedCategories(c, usr)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(mods) == 0 {
+			q = q.Where("unlisted = ?", false)
+		} else {
+			ids := make([]interface{}, 0, len(mods))
+			for _, cat := range mods {
+				ids = append(ids, cat.ID)
+			}
+			q = q.Where("(unlisted = false OR category_id IN (?))", ids...)
+		}
+	}
+	topics := models.Topics{}
+	if err := q.Order("created_at desc").All(&topics); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := loadListed(tx, topics); err != nil {
+		return errors.WithStack(err)
+	}
+	reads, err := models.LoadReadState(tx, usr, topics)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("tag", tag)
+	c.Set("topics", topics)
+	c.Set("reads", reads)
+	c.Set("pagination", q.Paginator)
+	return c.Render(200, r.HTML("tags/show"))
+}
+
+// loadListed loads the categories and the replies of topics, as listings
+// show them, in a query each.
+// Deleted replies are left out.
+func loadListed(tx *pop.Connection, topics models.Topics) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	tids := make([]interface{}, 0, len(topics))
+	cids := make([]interface{}, 0, len(topics))
+	for _, t := range topics {
+		tids = append(tids, t.ID)
+		cids = append(cids, t.CategoryID)
+	}
+	cats := models.Categories{}
+	if err := tx.Where("id IN (?)", cids...).All(&cats); err != nil {
+		return errors.WithStack(err)
+	}
+	byID := make(map[uuid.UUID]*models.Category, len(cats))
+	for i := range cats {
+		byID[cats[i].ID] = &cats[i]
+	}
+	replies := models.Replies{}
+	err := tx.Where("deleted = ?", false).Where("topic_id IN (?)", tids...).Order("created_at").All(&replies)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	byTopic := make(map[uuid.UUID]models.Replies, len(topics))
+	for _, r := range replies {
+		byTopic[r.TopicID] = append(byTopic[r.TopicID], r)
+	}
+	for i := range topics {
+		topics[i].Category = byID[topics[i].CategoryID]
+		topics[i].Replies = byTopic[topics[i].ID]
+	}
+	return nil
+}
+
+// TagsAddSubscriber subscribes the current user to a tag: the user is
+// then notified of the new topics and replies tagged with it.
+func TagsAddSubscriber(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	tag := models.NormalizeTag(c.Param("tag"))
+	if tag == "" {
+		return c.Error(404, errors.Errorf("no tag %q", c.Param("tag")))
+	}
+	usr := c.Value("current_user").(*models.User)
+	usr.AddTagSubscription(tag)
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Redirect(302, "/tags/%s", tag)
+}
+
+// TagsRemoveSubscriber unsubscribes the current user from a tag.
+func TagsRemoveSubscriber(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	tag := models.NormalizeTag(c.Param("tag"))
+	usr := c.Value("current_user").(*models.User)
+	usr.RemoveTagSubscription(tag)
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	if c.Param("from") == "settings" {
+		return c.Redirect(302, "/users/settings")
+	}
+	return c.Redirect(302, "/tags/%s", tag)
+}
+
+// UsersSettingsTags sets the tags topics may be tagged with.
+// Tags are free when none is set.
+func UsersSettingsTags(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	forum := c.Value("forum").(*models.Forum)
+	forum.Tags = models.ParseTags(c.Param("Tags"))
+	if err := tx.Update(forum); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Redirect(302, "/users/settings")
+}
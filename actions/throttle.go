@@ -0,0 +1,84 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-saloon/saloon/mailers"
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+// clientIP returns the address of the client that sent the request.
+// The X-Forwarded-For header is only trusted when SALOON_BEHIND_PROXY is
+// set, as clients could forge it otherwise.
+func clientIP(req *http.Request) string {
+	if envy.Get("SALOON_BEHIND_PROXY", "") != "" {
+		if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" {
+			// the last address was added by our proxy.
+			addrs := strings.Split(fwd, ",")
+			return strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// roundUp rounds d up to the second, for display.
+func roundUp(d time.Duration) time.Duration {
+	return (d + time.Second - 1).Truncate(time.Second)
+}
+
+// loginFailed records a failed login attempt, and warns the user by email
+// when the account gets locked out.
+// The attempt is recorded outside of the request transaction, so that it
+// is kept whatever the outcome of the request.
+func loginFailed(c buffalo.Context, username string, subjects []string) error {
+	locked, err := models.RecordLoginFailure(models.DB, subjects...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !locked {
+		return nil
+	}
+	tx := c.Value("tx").(*pop.Connection)
+	usr := new(models.User)
+	if err := tx.Where("username = ?", username).First(usr); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	log.Printf("login: account %q locked out after %d failed attempts", usr.Username, models.LoginLockoutAttempts)
+	return mailers.SendLockout(c, usr)
+}
+
+// UsersSettingsUnlock forgets the failed login attempts of a user,
+// lifting a lockout.
+func UsersSettingsUnlock(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := new(models.User)
+	if err := tx.Find(usr, c.Param("uid")); err != nil {
+		return c.Error(404, err)
+	}
+	if err := models.ResetLoginFailures(tx, models.UserThrottle(usr.Username)); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", fmt.Sprintf("The account of %s is unlocked.", usr.Username))
+	return c.Redirect(302, "/users/settings#%s", usr.ID)
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/middleware/csrf"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+// bearerToken returns the access token sent in the Authorization header
+// of the request, if any.
+func bearerToken(req *http.Request) string {
+	const prefix = "Bearer "
+	hdr := req.Header.Get("Authorization")
+	if len(hdr) < len(prefix) || !strings.EqualFold(hdr[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(hdr[len(prefix):])
+}
+
+// apiPrefix is the path prefix of the API routes, the only routes
+// accepting access tokens.
+const apiPrefix = "/api/v1/"
+
+// isAPIRequest reports whether the request is made to an API route.
+func isAPIRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, apiPrefix)
+}
+
+// CSRFUnlessToken protects against CSRF attacks the requests that are not
+// authenticated with an access token, which only API routes accept.
+// Browsers never send an Authorization header on their own, so these
+// requests can not be forged.
+func CSRFUnlessToken(next buffalo.Handler) buffalo.Handler {
+	protected := csrf.New(next)
+	return func(c buffalo.Context) error {
+		if bearerToken(c.Request()) == "" || !isAPIRequest(c.Request()) {
+			return protected(c)
+		}
+		c.Set("authenticity_token", "")
+		return next(c)
+	}
+}
+
+// setTokenUser sets the user owning the given access token as the
+// current user.
+// Access tokens are only accepted by the API: the scope of tokens is
+// checked against the method of requests, and only API routes are sure to
+// leave data unchanged on GET requests.
+func setTokenUser(c buffalo.Context, tok string, next buffalo.Handler) error {
+	if !isAPIRequest(c.Request()) {
+		return apiError(c, 401, "access tokens are only accepted by the API")
+	}
+	tx := c.Value("tx").(*pop.Connection)
+	at, err := models.FindAccessToken(tx, tok)
+	if err != nil {
+		if errors.Cause(err) == models.ErrInvalidToken {
+			return apiError(c, 401, "invalid access token")
+		}
+		return errors.WithStack(err)
+	}
+	if !at.Allows(c.Request().Method) {
+		return apiError(c, 403, "access token scope does not allow this request")
+	}
+	u := &models.User{}
+	if err := tx.Find(u, at.UserID); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return apiError(c, 401, "invalid access token")
+		}
+		return errors.WithStack(err)
+	}
+	// permissions are only granted to admin tokens.
+	if at.Scope == models.ScopeAdmin {
+		if err := u.LoadPermissions(tx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	c.Set("current_user", u)
+	c.Set("access_token", at)
+	return next(c)
+}
+
+// UsersSettingsTokens lists the personal access tokens of the current user.
+func UsersSettingsTokens(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	toks := new(models.AccessTokens)
+	if err := tx.Where("user_id = ?", usr.ID).Order("created_at desc").All(toks); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("tokens", toks)
+	c.Set("token", &models.AccessToken{Scope: models.ScopeRead})
+	return c.Render(200, r.HTML("users/tokens"))
+}
+
+// UsersSettingsTokensCreate creates a new personal access token and displays
+// it once.
+func UsersSettingsTokensCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	at := new(models.AccessToken)
+	if err := c.Bind(at); err != nil {
+		return errors.WithStack(err)
+	}
+	tok, verrs, err := at.Create(tx, usr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		toks := new(models.AccessTokens)
+		if err := tx.Where("user_id = ?", usr.ID).Order("created_at desc").All(toks); err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("tokens", toks)
+		c.Set("token", at)
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("users/tokens"))
+	}
+	c.Set("token", at)
+	c.Set("secret", tok)
+	return c.Render(200, r.HTML("users/token_created"))
+}
+
+// UsersSettingsTokensRevoke deletes a personal access token of the current user.
+func UsersSettingsTokensRevoke(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	at := new(models.AccessToken)
+	if err := tx.Find(at, c.Param("aid")); err != nil {
+		return c.Error(404, err)
+	}
+	if at.UserID != usr.ID {
+		c.Flash().Add("danger", "You are not authorized to revoke this token.")
+		return c.Redirect(302, "/users/settings/tokens")
+	}
+	if err := tx.Destroy(at); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Access token revoked.")
+	return c.Redirect(302, "/users/settings/tokens")
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	for _, tc := range []struct {
+		hdr  string
+		want string
+	}{
+		{"", ""},
+		{"Basic dXNlcjpwYXNz", ""},
+		{"Bearer", ""},
+		{"Bearer saloon_abc", "saloon_abc"},
+		{"bearer saloon_abc ", "saloon_abc"},
+	} {
+		t.Run(tc.hdr, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/categories", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.hdr != "" {
+				req.Header.Set("Authorization", tc.hdr)
+			}
+			if got := bearerToken(req); got != tc.want {
+				t.Fatalf("got=%q, want=%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsAPIRequest(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{"/api/v1/categories", true},
+		{"/api/v1/topics/x/replies", true},
+		{"/api/v1", false},
+		{"/topics/delete", false},
+		{"/users/settings/two-factor", false},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := isAPIRequest(req); got != tc.want {
+				t.Fatalf("got=%v, want=%v", got, tc.want)
+			}
+		})
+	}
+}
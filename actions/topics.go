@@ -6,12 +6,16 @@ package actions
 
 import (
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-saloon/saloon/mailers"
 	"github.com/go-saloon/saloon/models"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
 	"github.com/pkg/errors"
 )
 
@@ -28,68 +32,238 @@ func TopicsCreateGet(c buffalo.Context) error {
 	if err := tx.Find(cat, c.Param("cid")); err != nil {
 		return c.Error(404, err)
 	}
+	if cat.Archived {
+		c.Flash().Add("danger", "This category is archived: no new topics can be posted.")
+		return c.Redirect(302, "/categories/detail/%s", cat.ID)
+	}
 	c.Set("category", cat)
+	c.Set("poll", &models.Poll{})
 	topic.CategoryID = cat.ID
+	draft, err := restoreDraft(c, models.TopicDraftContext(cat.ID))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if draft != nil {
+		topic.Title, topic.Content = draft.Title, draft.Content
+	}
 
 	return c.Render(200, r.HTML("topics/create"))
 }
 
 func TopicsCreatePost(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
-	topic := &models.Topic{}
-	topic.Author = c.Value("current_user").(*models.User)
-	if err := c.Bind(topic); err != nil {
+	form := new(topicForm)
+	if err := c.Bind(form); err != nil {
 		return errors.WithStack(err)
 	}
 	cat := new(models.Category)
 	if err := tx.Find(cat, c.Param("cid")); err != nil {
 		return c.Error(404, err)
 	}
-	topic.Category = cat
-	topic.AuthorID = topic.Author.ID
-	topic.CategoryID = topic.Category.ID
-	topic.AddSubscriber(topic.AuthorID)
-	// Validate the data from the html form
-	verrs, err := tx.ValidateAndCreate(topic)
+	if cat.Archived {
+		c.Flash().Add("danger", "This category is archived: no new topics can be posted.")
+		return c.Redirect(302, "/categories/detail/%s", cat.ID)
+	}
+	topic := &models.Topic{
+		Title:      form.Title,
+		Content:    form.Content,
+		Category:   cat,
+		CategoryID: cat.ID,
+		Tags:       models.ParseTags(c.Param("TagList")),
+	}
+	poll, verrs := pollParams(c)
+	uploads, aerrs, err := attachmentParams(c, uuid.Nil)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	verrs.Append(aerrs)
+	if !verrs.HasAny() {
+		verrs, err = createTopic(c, topic, poll, uploads)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	if verrs.HasAny() {
 		c.Set("topic", topic)
+		c.Set("category", cat)
+		c.Set("poll", pollOrEmpty(poll))
 		c.Set("errors", verrs.Errors)
 		return c.Render(422, r.HTML("topics/create"))
 	}
 
-	err = newTopicNotify(c, topic)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
 	c.Flash().Add("success", "New topic added successfully.")
 	return c.Redirect(302, "/topics/detail/%s", topic.ID)
 }
 
+// createTopic creates a topic on behalf of the current user, with its
+// poll and the uploaded files attached to it, if any. Web and API posts
+// both go through it.
+// The author is subscribed to the topic, their draft is deleted and the
+// users following its category or tags are notified.
+func createTopic(c buffalo.Context, topic *models.Topic, poll *models.Poll, uploads []upload) (*validate.Errors, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	topic.Author = usr
+	topic.AuthorID = usr.ID
+	topic.AddSubscriber(usr.ID)
+	verrs := c.Value("forum").(*models.Forum).CheckTags(topic.Tags)
+	if poll != nil {
+		pverrs, err := poll.Validate(tx)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		verrs.Append(pverrs)
+	}
+	if verrs.HasAny() {
+		return verrs, nil
+	}
+	verrs, err := tx.ValidateAndCreate(topic)
+	if err != nil || verrs.HasAny() {
+		return verrs, errors.WithStack(err)
+	}
+	if poll != nil {
+		poll.TopicID = topic.ID
+		if err := tx.Create(poll); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err := saveAttachments(c, topic.ID, topic.ID, uploads); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := models.DeleteDraft(tx, usr.ID, models.TopicDraftContext(topic.CategoryID)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := newTopicNotify(c, topic); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return verrs, nil
+}
+
 func TopicsEditGet(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 	topic := new(models.Topic)
 	if err := tx.Find(topic, c.Param("tid")); err != nil {
 		return c.Error(404, err)
 	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if usr := c.Value("current_user").(*models.User); !usr.CanEditIn(topic.AuthorID, topic, cat) {
+		c.Flash().Add("danger", "You are not authorized to edit this topic")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, topic.ID)
+	}
+	poll, err := models.FindPoll(tx, topic.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	atts, err := models.PostAttachments(tx, topic.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := setEditTargets(c, topic, cat); err != nil {
+		return errors.WithStack(err)
+	}
 	c.Set("topic", topic)
+	c.Set("poll", pollOrEmpty(poll))
+	c.Set("postAttachments", atts)
 	return c.Render(200, r.HTML("topics/edit"))
 }
 
+// topicForm holds the fields of a topic that its author may set.
+// The moderation state of the topic is never taken from the form.
+type topicForm struct {
+	Title   string `form:"Title"`
+	Content string `form:"Content"`
+}
+
 func TopicsEditPost(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 	topic := new(models.Topic)
 	if err := tx.Find(topic, c.Param("tid")); err != nil {
 		return errors.WithStack(err)
 	}
-	if err := c.Bind(topic); err != nil {
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	if !usr.CanEditIn(topic.AuthorID, topic, cat) {
+		c.Flash().Add("danger", "You are not authorized to edit this topic")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, topic.ID)
+	}
+	orig := topic.Revision(topic.AuthorID, "")
+	orig.CreatedAt = topic.CreatedAt
+	form := new(topicForm)
+	if err := c.Bind(form); err != nil {
+		return errors.WithStack(err)
+	}
+	topic.Title, topic.Content = form.Title, form.Content
+	topic.Tags = models.ParseTags(c.Param("TagList"))
+	poll, verrs := pollParams(c)
+	verrs.Append(c.Value("forum").(*models.Forum).CheckTags(topic.Tags))
+	uploads, aerrs, err := attachmentParams(c, topic.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	verrs.Append(aerrs)
+	var dst *models.Category
+	if cid := c.Param("CategoryID"); cid != "" && cid != cat.ID.String() {
+		var reason string
+		dst, reason, err = moveDestination(c, usr, cat, cid)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if reason != "" {
+			verrs.Add("category", reason)
+		}
+	}
+	if !verrs.HasAny() {
+		pverrs, err := savePoll(tx, topic, poll)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		verrs.Append(pverrs)
+	}
+	if verrs.HasAny() {
+		atts, err := models.PostAttachments(tx, topic.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := setEditTargets(c, topic, cat); err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("topic", topic)
+		c.Set("poll", pollOrEmpty(poll))
+		c.Set("postAttachments", atts)
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("topics/edit"))
+	}
+	if err := removeAttachments(c, topic.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := saveAttachments(c, topic.ID, topic.ID, uploads); err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := tx.Update(topic); err != nil {
+	if err := saveEdit(tx, topic, orig, topic.Revision(usr.ID, c.Param("Reason"))); err != nil {
+		return errors.WithStack(err)
+	}
+	if dst != nil {
+		if err := models.MoveTopic(tx, topic, dst.ID, usr.ID); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := reindexTopic(tx, topic.ID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := mentionNotify(c, topic, uuid.Nil, usr, topic.Content, orig.Content, nil); err != nil {
 		return errors.WithStack(err)
 	}
 	c.Flash().Add("success", "Topic edited successfully.")
@@ -103,10 +277,13 @@ func TopicsDelete(c buffalo.Context) error {
 		return errors.WithStack(err)
 	}
 	usr := c.Value("current_user").(*models.User)
-	if !usr.Admin && usr.ID != topic.AuthorID {
+	if !usr.CanDelete(topic.AuthorID, topic.Category) {
 		c.Flash().Add("danger", "You are not authorized to delete this topic")
 		return c.Redirect(302, "/topics/detail/%s", topic.ID)
 	}
+	if topic.Category.Archived {
+		return refuseArchived(c, topic.ID)
+	}
 	tx := c.Value("tx").(*pop.Connection)
 	topic.Deleted = true
 	if err := tx.Update(topic); err != nil {
@@ -122,12 +299,149 @@ func TopicsDetail(c buffalo.Context) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	if topic.MergedInto.Valid {
+		return c.Redirect(301, "/topics/detail/%s", topic.MergedInto.UUID)
+	}
 	c.Set("topic", topic)
 	c.Set("category", topic.Category)
-	c.Set("replies", &topic.Replies)
+	if c.Param("view") == "threaded" {
+		c.Set("threaded", true)
+		c.Set("replies", topic.Replies.Thread())
+	} else {
+		c.Set("threaded", false)
+		c.Set("replies", topic.Replies.Flat())
+	}
+	tx := c.Value("tx").(*pop.Connection)
+	cats, err := allCategories(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("breadcrumbs", cats.Ancestors(topic.CategoryID))
+	if err := setReactions(c, topic); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := setPoll(c, topic); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := setAttachments(c, topic); err != nil {
+		return errors.WithStack(err)
+	}
+	usr := c.Value("current_user").(*models.User)
+	solution := topic.Solution()
+	c.Set("hasSolution", solution != nil)
+	if solution != nil {
+		c.Set("solution", solution)
+	}
+	c.Set("canSolve", (usr.ID == topic.AuthorID || usr.Moderates(topic.Category)) && !topic.Category.Archived)
+	if usr.Moderates(topic.Category) {
+		targets, err := moveTargets(c, usr, topic)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("moveTargets", targets)
+	}
+	// the jump link leads to the first unread reply; the topic is then
+	// read up to its last post.
+	reads, err := models.LoadReadState(tx, usr, models.Topics{*topic})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	first := reads.FirstUnread(*topic)
+	c.Set("hasUnread", first != uuid.Nil && first != topic.ID)
+	c.Set("firstUnread", first)
+	if err := models.MarkTopicRead(tx, usr.ID, topic.ID, topic.LastPost()); err != nil {
+		return errors.WithStack(err)
+	}
 	return c.Render(200, r.HTML("topics/detail"))
 }
 
+// TopicsState changes the moderation state of a topic, as given by the
+// State parameter (one of the models.Event* state changes), and records
+// the change as an event post in the thread of the topic.
+// Only moderators may change the state of a topic, and only global
+// moderators may pin a topic globally.
+func TopicsState(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("tid")); err != nil {
+		return c.Error(404, err)
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	event := c.Param("State")
+	if !usr.Moderates(cat) || (event == models.EventPinnedGlobally && !usr.Can(models.PermModerate)) {
+		c.Flash().Add("danger", "You are not authorized to change the state of this topic")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, topic.ID)
+	}
+	changed, err := topic.SetState(event)
+	if err != nil {
+		return c.Error(400, err)
+	}
+	if !changed {
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if err := tx.Update(topic); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := models.AddEvent(tx, topic.ID, usr.ID, event); err != nil {
+		return errors.WithStack(err)
+	}
+	if event == models.EventUnlisted || event == models.EventListed {
+		if err := reindexTopic(tx, topic.ID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	c.Flash().Add("success", "Topic state changed.")
+	return c.Redirect(302, "/topics/detail/%s", topic.ID)
+}
+
+// TopicsSolve marks the reply given by the rid parameter as the solution
+// of a topic, or unmarks the solution when rid is empty.
+// Only the author of the topic and moderators may mark solutions.
+func TopicsSolve(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	topic := new(models.Topic)
+	if err := tx.Find(topic, c.Param("tid")); err != nil {
+		return c.Error(404, err)
+	}
+	cat, err := findCategory(tx, topic.CategoryID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if topic.AuthorID != usr.ID && !usr.Moderates(cat) {
+		c.Flash().Add("danger", "You are not authorized to mark the solution of this topic")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	if cat.Archived {
+		return refuseArchived(c, topic.ID)
+	}
+	if c.Param("rid") == "" {
+		topic.SolutionID = nulls.UUID{}
+		if err := tx.Update(topic); err != nil {
+			return errors.WithStack(err)
+		}
+		c.Flash().Add("success", "Solution unmarked.")
+		return c.Redirect(302, "/topics/detail/%s", topic.ID)
+	}
+	reply := new(models.Reply)
+	if err := tx.Find(reply, c.Param("rid")); err != nil || reply.Deleted || reply.Event != "" || reply.TopicID != topic.ID {
+		return c.Error(404, errors.Errorf("no reply %s in topic %s", c.Param("rid"), topic.ID))
+	}
+	topic.SolutionID = nulls.NewUUID(reply.ID)
+	if err := tx.Update(topic); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Solution marked.")
+	return c.Redirect(302, "/topics/detail/%s#%s", topic.ID, reply.ID)
+}
+
 func TopicsAddSubscriber(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 	topic, err := loadTopic(c, c.Param("tid"))
@@ -145,9 +459,6 @@ func TopicsAddSubscriber(c buffalo.Context) error {
 		return errors.WithStack(err)
 	}
 
-	c.Set("topic", topic)
-	c.Set("category", topic.Category)
-	c.Set("replies", &topic.Replies)
 	return c.Redirect(302, "/topics/detail/%s", topic.ID)
 }
 
@@ -168,18 +479,181 @@ func TopicsRemoveSubscriber(c buffalo.Context) error {
 		return errors.WithStack(err)
 	}
 
-	c.Set("topic", topic)
-	c.Set("category", topic.Category)
-	c.Set("replies", &topic.Replies)
 	return c.Redirect(302, "/topics/detail/%s", topic.ID)
 }
 
-func loadTopic(c buffalo.Context, tid string) (*models.Topic, error) {
+// findCategory retrieves the category of a topic.
+func findCategory(tx *pop.Connection, id uuid.UUID) (*models.Category, error) {
+	cat := new(models.Category)
+	if err := tx.Find(cat, id); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cat, nil
+}
+
+// usernames returns the usernames of the users ids, keyed by user ID.
+func usernames(tx *pop.Connection, ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	users, err := findUsers(tx, ids)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	names := make(map[uuid.UUID]string, len(users))
+	for id, usr := range users {
+		names[id] = usr.Username
+	}
+	return names, nil
+}
+
+// findUsers returns the users of the given IDs, keyed by ID.
+func findUsers(tx *pop.Connection, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	in, args := inList(ids)
+	found := models.Users{}
+	if err := tx.Where("id IN "+in, args...).All(&found); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i := range found {
+		users[found[i].ID] = &found[i]
+	}
+	return users, nil
+}
+
+// postCount is the number of replies of a topic.
+type postCount struct {
+	TopicID uuid.UUID `db:"topic_id"`
+	Count   int       `db:"count"`
+}
+
+// countPosts returns the number of replies of the given topics, events
+// and deleted replies left out.
+func countPosts(tx *pop.Connection, topics []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int, len(topics))
+	if len(topics) == 0 {
+		return counts, nil
+	}
+	in, args := inList(topics)
+	rows := []postCount{}
+	q := "SELECT topic_id, COUNT(*) AS count FROM replies WHERE deleted = false AND event = '' AND topic_id IN " + in + " GROUP BY topic_id"
+	if err := tx.RawQuery(q, args...).All(&rows); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, r := range rows {
+		counts[r.TopicID] = r.Count
+	}
+	return counts, nil
+}
+
+// topicListing is what topic lists show of a topic: its authors, its
+// number of replies and its last activity.
+type topicListing struct {
+	Authors    models.Users
+	Posts      int
+	LastUpdate time.Time
+}
+
+// participation is the share of an author in the replies of a topic,
+// events included but not counted as posts.
+type participation struct {
+	TopicID    uuid.UUID `db:"topic_id"`
+	AuthorID   uuid.UUID `db:"author_id"`
+	Posts      int       `db:"posts"`
+	LastUpdate time.Time `db:"last_update"`
+}
+
+// listTopics returns the listings of topics, keyed by topic ID, from one
+// grouped query over their replies rather than loading every topic.
+func listTopics(tx *pop.Connection, topics models.Topics) (map[string]topicListing, error) {
+	listings := make(map[string]topicListing, len(topics))
+	if len(topics) == 0 {
+		return listings, nil
+	}
+	tids := make([]uuid.UUID, 0, len(topics))
+	uids := make([]uuid.UUID, 0, len(topics))
+	for _, t := range topics {
+		tids = append(tids, t.ID)
+		uids = append(uids, t.AuthorID)
+	}
+	in, args := inList(tids)
+	rows := []participation{}
+	q := "SELECT topic_id, author_id, COUNT(*) FILTER (WHERE event = '') AS posts, MAX(GREATEST(created_at, updated_at)) AS last_update" +
+		" FROM replies WHERE deleted = false AND topic_id IN " + in +
+		" GROUP BY topic_id, author_id ORDER BY MIN(created_at)"
+	if err := tx.RawQuery(q, args...).All(&rows); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	byTopic := make(map[uuid.UUID][]participation, len(topics))
+	for _, r := range rows {
+		byTopic[r.TopicID] = append(byTopic[r.TopicID], r)
+		if r.Posts > 0 {
+			uids = append(uids, r.AuthorID)
+		}
+	}
+	users, err := findUsers(tx, uids)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, t := range topics {
+		l := topicListing{LastUpdate: t.CreatedAt.UTC()}
+		if t.UpdatedAt.After(l.LastUpdate) {
+			l.LastUpdate = t.UpdatedAt.UTC()
+		}
+		seen := make(map[uuid.UUID]bool)
+		add := func(uid uuid.UUID) {
+			if usr := users[uid]; usr != nil && !seen[uid] {
+				seen[uid] = true
+				l.Authors = append(l.Authors, *usr)
+			}
+		}
+		add(t.AuthorID)
+		for _, r := range byTopic[t.ID] {
+			l.Posts += r.Posts
+			if r.Posts > 0 {
+				add(r.AuthorID)
+			}
+			if r.LastUpdate.After(l.LastUpdate) {
+				l.LastUpdate = r.LastUpdate.UTC()
+			}
+		}
+		listings[t.ID.String()] = l
+	}
+	return listings, nil
+}
+
+// inList returns the placeholders of an IN list of ids, such as
+// "(?, ?, ?)", and the matching arguments, for Where clauses and raw
+// queries alike: pop only expands "IN (?)" in the former.
+// ids must not be empty.
+func inList(ids []uuid.UUID) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return "(?" + strings.Repeat(", ?", len(ids)-1) + ")", args
+}
+
+// moderatedCategories returns the categories the user moderates.
+func moderatedCategories(c buffalo.Context, usr *models.User) (models.Categories, error) {
 	tx := c.Value("tx").(*pop.Connection)
-	topic := &models.Topic{}
-	if err := c.Bind(topic); err != nil {
+	cats := new(models.Categories)
+	if err := tx.All(cats); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	sort.Sort(cats)
+	var mods models.Categories
+	for i := range *cats {
+		if usr.Moderates(&(*cats)[i]) {
+			mods = append(mods, (*cats)[i])
+		}
+	}
+	return mods, nil
+}
+
+func loadTopic(c buffalo.Context, tid string) (*models.Topic, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	topic := &models.Topic{}
 	if err := tx.Find(topic, tid); err != nil {
 		return nil, c.Error(404, err)
 	}
@@ -219,32 +693,49 @@ func newReplyNotify(c buffalo.Context, topic *models.Topic, reply *models.Reply)
 	}
 	set[reply.AuthorID] = struct{}{}
 
-	cat := new(models.Category)
 	tx := c.Value("tx").(*pop.Connection)
-	if err := tx.Find(cat, topic.CategoryID); err != nil {
+	cats, err := allCategories(tx)
+	if err != nil {
 		return errors.WithStack(err)
 	}
-	for _, usr := range cat.Subscribers {
+	for _, usr := range cats.Subscribers(topic.CategoryID) {
 		set[usr] = struct{}{}
 	}
+	// the author of the answered reply is notified, even when not subscribed.
+	if reply.ParentReplyID.Valid {
+		parent := new(models.Reply)
+		if err := tx.Find(parent, reply.ParentReplyID.UUID); err != nil {
+			return errors.WithStack(err)
+		}
+		set[parent.AuthorID] = struct{}{}
+	}
 
 	users := new(models.Users)
 	if err := tx.All(users); err != nil {
 		return errors.WithStack(err)
 	}
+	// subscribers of a tag follow the topics tagged with it.
+	for _, usr := range *users {
+		if usr.FollowsTags(topic.Tags) {
+			set[usr.ID] = struct{}{}
+		}
+	}
 
 	var recpts []models.User
 	for _, usr := range *users {
 		if _, ok := set[usr.ID]; !ok {
 			continue
 		}
+		if !usr.EmailVerified {
+			continue
+		}
 		recpts = append(recpts, usr)
 	}
 
-	err := mailers.NewReplyNotify(c, topic, reply, recpts)
+	err = mailers.NewReplyNotify(c, topic, reply, recpts)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	return mentionNotify(c, topic, reply.ID, reply.Author, reply.Content, "", set)
 }
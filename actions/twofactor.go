@@ -0,0 +1,247 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actions
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+	"rsc.io/qr"
+)
+
+// twoFactorTimeout is how long a user has to enter the second factor
+// after having entered a valid password.
+const twoFactorTimeout = 5 * time.Minute
+
+// startTwoFactor records in the session that the user entered a valid
+// password and still has to enter a TOTP code.
+func startTwoFactor(c buffalo.Context, user *models.User) {
+	c.Session().Set("pending_user_id", user.ID)
+	c.Session().Set("pending_user_since", time.Now().Unix())
+}
+
+// pendingTwoFactorUser returns the user waiting for the second login step,
+// if any.
+func pendingTwoFactorUser(c buffalo.Context) (*models.User, error) {
+	uid := c.Session().Get("pending_user_id")
+	since, _ := c.Session().Get("pending_user_since").(int64)
+	if uid == nil || time.Since(time.Unix(since, 0)) > twoFactorTimeout {
+		return nil, nil
+	}
+	tx := c.Value("tx").(*pop.Connection)
+	usr := new(models.User)
+	if err := tx.Find(usr, uid); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return usr, nil
+}
+
+// checkSecondFactor verifies a TOTP code or, failing that, a recovery code.
+func checkSecondFactor(tx *pop.Connection, usr *models.User, code string) (bool, error) {
+	if usr.CheckTOTP(code) {
+		if err := tx.Update(usr); err != nil {
+			return false, errors.WithStack(err)
+		}
+		return true, nil
+	}
+	return models.UseRecoveryCode(tx, usr, code)
+}
+
+// UsersLoginTwoFactorGet displays the form asking for a TOTP code.
+func UsersLoginTwoFactorGet(c buffalo.Context) error {
+	usr, err := pendingTwoFactorUser(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if usr == nil {
+		return c.Redirect(302, "/users/login")
+	}
+	return c.Render(200, r.HTML("users/login_two_factor"))
+}
+
+// UsersLoginTwoFactorPost checks the TOTP code of a user who entered
+// a valid password, and logs the user in.
+func UsersLoginTwoFactorPost(c buffalo.Context) error {
+	usr, err := pendingTwoFactorUser(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if usr == nil {
+		c.Flash().Add("danger", "Your login attempt has expired. Please log in again.")
+		return c.Redirect(302, "/users/login")
+	}
+
+	tx := c.Value("tx").(*pop.Connection)
+	subjects := []string{
+		models.UserThrottle(usr.Username),
+		models.IPThrottle(clientIP(c.Request())),
+	}
+	wait, err := models.LoginBlocked(tx, subjects...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if wait > 0 {
+		verrs := validate.NewErrors()
+		verrs.Add("Code", fmt.Sprintf("Too many failed login attempts. Try again in %v.", roundUp(wait)))
+		c.Set("errors", verrs.Errors)
+		return c.Render(429, r.HTML("users/login_two_factor"))
+	}
+	ok, err := checkSecondFactor(tx, usr, c.Param("Code"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		if err := loginFailed(c, usr.Username, subjects); err != nil {
+			return errors.WithStack(err)
+		}
+		verrs := validate.NewErrors()
+		verrs.Add("Code", "Invalid authentication code.")
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("users/login_two_factor"))
+	}
+	if err := models.ResetLoginFailures(tx, subjects[0]); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Session().Delete("pending_user_id")
+	c.Session().Delete("pending_user_since")
+	if err := logIn(c, usr); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Welcome back!")
+	return c.Redirect(302, "/")
+}
+
+// UsersSettingsTwoFactor displays the two-factor authentication settings.
+// When two-factor authentication is disabled, the secret prepared by
+// UsersSettingsTwoFactorSetup, if any, is displayed for the user to enroll.
+func UsersSettingsTwoFactor(c buffalo.Context) error {
+	usr := c.Value("current_user").(*models.User)
+	c.Set("totpPending", !usr.TOTPEnabled && usr.TOTPSecret != "")
+	if !usr.TOTPEnabled && usr.TOTPSecret != "" {
+		forum := c.Value("forum").(*models.Forum)
+		uri := models.TOTPURI(forum.Title, usr.Username, usr.TOTPSecret)
+		code, err := qr.Encode(uri, qr.M)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("totpURI", uri)
+		c.Set("totpQRCode", base64.StdEncoding.EncodeToString(code.PNG()))
+	}
+	return c.Render(200, r.HTML("users/two_factor"))
+}
+
+// UsersSettingsTwoFactorSetup prepares a new secret for the user to enroll
+// an authenticator, replacing any secret prepared earlier.
+func UsersSettingsTwoFactorSetup(c buffalo.Context) error {
+	usr := c.Value("current_user").(*models.User)
+	if usr.TOTPEnabled {
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
+	secret, err := models.NewTOTPSecret()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	usr.TOTPSecret = secret
+	tx := c.Value("tx").(*pop.Connection)
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Redirect(302, "/users/settings/two-factor")
+}
+
+// UsersSettingsTwoFactorEnable enables two-factor authentication once the
+// user proved the authenticator was correctly set up.
+func UsersSettingsTwoFactorEnable(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	if usr.TOTPEnabled || usr.TOTPSecret == "" {
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
+	if !usr.CheckTOTP(c.Param("Code")) {
+		c.Flash().Add("danger", "Invalid authentication code.")
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
+	usr.TOTPEnabled = true
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	codes, err := models.NewRecoveryCodes(tx, usr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("codes", codes)
+	c.Flash().Add("success", "Two-factor authentication is now enabled.")
+	return c.Render(200, r.HTML("users/recovery_codes"))
+}
+
+// UsersSettingsTwoFactorDisable disables two-factor authentication.
+func UsersSettingsTwoFactorDisable(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	if !usr.TOTPEnabled {
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
+	ok, err := checkSecondFactor(tx, usr, c.Param("Code"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		c.Flash().Add("danger", "Invalid authentication code.")
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
+	usr.TOTPEnabled = false
+	usr.TOTPSecret = ""
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	err = tx.RawQuery("DELETE FROM recovery_codes WHERE user_id = ?", usr.ID).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Two-factor authentication is now disabled.")
+	return c.Redirect(302, "/users/settings/two-factor")
+}
+
+// UsersSettingsTwoFactorRecoveryCodes replaces the recovery codes of the user.
+func UsersSettingsTwoFactorRecoveryCodes(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	usr := c.Value("current_user").(*models.User)
+	if !usr.TOTPEnabled {
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
+	ok, err := checkSecondFactor(tx, usr, c.Param("Code"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		c.Flash().Add("danger", "Invalid authentication code.")
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
+	codes, err := models.NewRecoveryCodes(tx, usr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("codes", codes)
+	return c.Render(200, r.HTML("users/recovery_codes"))
+}
+
+// UsersSettingsRequireAdminTwoFactor sets whether admins must enable
+// two-factor authentication to access admin pages.
+func UsersSettingsRequireAdminTwoFactor(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	forum := c.Value("forum").(*models.Forum)
+	forum.RequireAdmin2FA = c.Param("RequireAdmin2FA") == "true"
+	if err := tx.Update(forum); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Redirect(302, "/users/settings")
+}
@@ -13,6 +13,7 @@ import (
 	_ "image/jpeg"
 	"image/png"
 	"sort"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -22,9 +23,12 @@ import (
 	_ "golang.org/x/image/webp"
 
 	"github.com/disintegration/letteravatar"
+	"github.com/go-saloon/saloon/login"
+	"github.com/go-saloon/saloon/mailers"
 	"github.com/go-saloon/saloon/models"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/pkg/errors"
 )
@@ -51,19 +55,9 @@ func UsersRegisterPost(c buffalo.Context) error {
 	}
 	user.Avatar = avatar
 	tx := c.Value("tx").(*pop.Connection)
-
-	// subscribe user with all categories.
-	// FIXME(sbinet) we should make the list of default categories
-	// customizable at the application level...
-	// see:
-	//   go-saloon/saloon#8
-	cats := new(models.Categories)
-	if err := tx.All(cats); err != nil {
+	if err := subscribeAllCategories(tx, user); err != nil {
 		return errors.WithStack(err)
 	}
-	for _, cat := range *cats {
-		user.AddSubscription(cat.ID)
-	}
 
 	verrs, err := user.Create(tx)
 	if err != nil {
@@ -78,15 +72,37 @@ func UsersRegisterPost(c buffalo.Context) error {
 		// correct the input.
 		return c.Render(422, r.HTML("users/register.html"))
 	}
+	if err := mailers.SendEmailVerification(c, user); err != nil {
+		return errors.WithStack(err)
+	}
 	// If there are no errors set a success message
-	c.Flash().Add("success", "Account created successfully.")
-	c.Session().Set("current_user_id", user.ID)
+	c.Flash().Add("success", "Account created successfully. Check your mailbox to confirm your email address.")
+	if err := logIn(c, user); err != nil {
+		return errors.WithStack(err)
+	}
 	// and redirect to the home page
 	return c.Redirect(302, "/")
 }
 
+// subscribeAllCategories subscribes a new user with all categories.
+func subscribeAllCategories(tx *pop.Connection, user *models.User) error {
+	// FIXME(sbinet) we should make the list of default categories
+	// customizable at the application level...
+	// see:
+	//   go-saloon/saloon#8
+	cats := new(models.Categories)
+	if err := tx.All(cats); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, cat := range *cats {
+		user.AddSubscription(cat.ID)
+	}
+	return nil
+}
+
 // UsersLoginGet displays a login form
 func UsersLoginGet(c buffalo.Context) error {
+	c.Set("providers", login.Providers())
 	return c.Render(200, r.HTML("users/login"))
 }
 
@@ -98,30 +114,90 @@ func UsersLoginPost(c buffalo.Context) error {
 		return errors.WithStack(err)
 	}
 	tx := c.Value("tx").(*pop.Connection)
-	err := user.Authorize(tx)
+	subjects := []string{
+		models.UserThrottle(user.Username),
+		models.IPThrottle(clientIP(c.Request())),
+	}
+	wait, err := models.LoginBlocked(tx, subjects...)
 	if err != nil {
+		return errors.WithStack(err)
+	}
+	if wait > 0 {
+		c.Set("user", user)
+		verrs := validate.NewErrors()
+		verrs.Add("Login", fmt.Sprintf("Too many failed login attempts. Try again in %v.", roundUp(wait)))
+		c.Set("errors", verrs.Errors)
+		c.Set("providers", login.Providers())
+		return c.Render(429, r.HTML("users/login"))
+	}
+	err = user.Authorize(tx)
+	if err != nil {
+		if err := loginFailed(c, user.Username, subjects); err != nil {
+			return errors.WithStack(err)
+		}
 		c.Set("user", user)
 		verrs := validate.NewErrors()
 		verrs.Add("Login", "Invalid user or password.")
 		c.Set("errors", verrs.Errors)
+		c.Set("providers", login.Providers())
 		return c.Render(422, r.HTML("users/login"))
 	}
-	c.Session().Set("current_user_id", user.ID)
+	if err := models.ResetLoginFailures(tx, subjects[0]); err != nil {
+		return errors.WithStack(err)
+	}
+	if user.TOTPEnabled {
+		startTwoFactor(c, user)
+		return c.Redirect(302, "/users/login/two-factor")
+	}
+	if err := logIn(c, user); err != nil {
+		return errors.WithStack(err)
+	}
 	c.Flash().Add("success", "Welcome back!")
+	if err := user.LoadPermissions(tx); err != nil {
+		return errors.WithStack(err)
+	}
+	if forum := c.Value("forum").(*models.Forum); forum.RequireAdmin2FA && user.Privileged() {
+		c.Flash().Add("warning", "Administrators must enable two-factor authentication.")
+		return c.Redirect(302, "/users/settings/two-factor")
+	}
 	return c.Redirect(302, "/")
 }
 
+// logIn records a new session for the user and stores it in the
+// session cookie.
+func logIn(c buffalo.Context, user *models.User) error {
+	tx := c.Value("tx").(*pop.Connection)
+	req := c.Request()
+	sess, err := models.NewUserSession(tx, user, req.UserAgent(), clientIP(req))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Session().Set("current_user_id", user.ID)
+	c.Session().Set("current_session_id", sess.ID.String())
+	return nil
+}
+
 // UsersLogout clears the session and logs out the user.
 func UsersLogout(c buffalo.Context) error {
+	if sess, ok := c.Value("current_session").(*models.UserSession); ok {
+		tx := c.Value("tx").(*pop.Connection)
+		if err := tx.Destroy(sess); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	c.Session().Clear()
 	c.Flash().Add("success", "Goodbye!")
 	return c.Redirect(302, "/")
 }
 
-// SetCurrentUser attempts to find a user based on the current_user_id
-// in the session. If one is found it is set on the context.
+// SetCurrentUser attempts to find a user based on the access token of the
+// request or on the current_user_id in the session.
+// If one is found it is set on the context.
 func SetCurrentUser(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
+		if tok := bearerToken(c.Request()); tok != "" {
+			return setTokenUser(c, tok, next)
+		}
 		if uid := c.Session().Get("current_user_id"); uid != nil {
 			u := &models.User{}
 			tx := c.Value("tx").(*pop.Connection)
@@ -133,6 +209,27 @@ func SetCurrentUser(next buffalo.Handler) buffalo.Handler {
 				}
 				return errors.WithStack(err)
 			}
+			// the session must not have been revoked.
+			var sess *models.UserSession
+			str, _ := c.Session().Get("current_session_id").(string)
+			if sid, err := uuid.FromString(str); err == nil {
+				sess, err = models.FindUserSession(tx, sid, u.ID)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			if sess == nil {
+				c.Session().Clear()
+				c.Flash().Add("warning", "Your session has expired. Please log in again.")
+				return c.Redirect(302, "/users/login")
+			}
+			if err := sess.Touch(tx, clientIP(c.Request())); err != nil {
+				return errors.WithStack(err)
+			}
+			c.Set("current_session", sess)
+			if err := u.LoadPermissions(tx); err != nil {
+				return errors.WithStack(err)
+			}
 			c.Set("current_user", u)
 		}
 		return next(c)
@@ -142,21 +239,54 @@ func SetCurrentUser(next buffalo.Handler) buffalo.Handler {
 // UserSettings displays the user's informations
 func UsersSettings(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
-	cats := new(models.Categories)
-	if err := tx.All(cats); err != nil {
+	cats, err := allCategories(tx)
+	if err != nil {
 		return errors.WithStack(err)
 	}
-	sort.Sort(cats)
 	c.Set("categories", cats)
+	c.Set("categoryTree", cats.Tree())
 	c.Set("avatar", new(models.Avatar))
 	usr := c.Value("current_user").(*models.User)
-	if usr.Admin {
+	idents := new(models.UserIdentities)
+	if err := tx.Where("user_id = ?", usr.ID).All(idents); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("identities", idents)
+	c.Set("providers", login.Providers())
+	sessions := new(models.UserSessions)
+	if err := tx.Where("user_id = ?", usr.ID).All(sessions); err != nil {
+		return errors.WithStack(err)
+	}
+	sort.Sort(sessions)
+	c.Set("sessions", sessions)
+	currentSessionID := ""
+	if sess, ok := c.Value("current_session").(*models.UserSession); ok {
+		currentSessionID = sess.ID.String()
+	}
+	c.Set("currentSessionID", currentSessionID)
+	drafts, err := userDrafts(tx, usr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("drafts", drafts)
+	if usr.Can(models.PermManageUsers) {
 		users := new(models.Users)
 		if err := tx.All(users); err != nil {
 			return errors.WithStack(err)
 		}
 		sort.Sort(users)
 		c.Set("users", users)
+		locked, err := models.LockedOutUsers(tx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		lockedOut := make(map[string]bool, len(locked))
+		for _, u := range *users {
+			if locked[strings.ToLower(u.Username)] {
+				lockedOut[u.ID.String()] = true
+			}
+		}
+		c.Set("lockedOut", lockedOut)
 	}
 	return c.Render(200, r.HTML("users/settings"))
 }
@@ -171,6 +301,10 @@ func UsersSettingsAddSubscription(c buffalo.Context) error {
 	if err := tx.Find(usr, c.Param("uid")); err != nil {
 		return errors.WithStack(err)
 	}
+	if cur := c.Value("current_user").(*models.User); cur.ID != usr.ID && !cur.Can(models.PermManageUsers) {
+		c.Flash().Add("danger", "You are not authorized to manage this user.")
+		return c.Redirect(302, "/users/settings")
+	}
 	usr.AddSubscription(cat.ID)
 	cat.AddSubscriber(usr.ID)
 
@@ -193,6 +327,10 @@ func UsersSettingsRemoveSubscription(c buffalo.Context) error {
 	if err := tx.Find(usr, c.Param("uid")); err != nil {
 		return errors.WithStack(err)
 	}
+	if cur := c.Value("current_user").(*models.User); cur.ID != usr.ID && !cur.Can(models.PermManageUsers) {
+		c.Flash().Add("danger", "You are not authorized to manage this user.")
+		return c.Redirect(302, "/users/settings")
+	}
 	usr.RemoveSubscription(cat.ID)
 	if err := tx.Update(usr); err != nil {
 		return errors.WithStack(err)
@@ -244,12 +382,26 @@ func UsersSettingsUpdateAvatar(c buffalo.Context) error {
 	return c.Redirect(302, "/users/settings")
 }
 
+// nameForm holds the full name entered on the settings page.
+type nameForm struct {
+	FullName string `form:"full_name"`
+}
+
+// emailForm holds the email address entered on the settings page.
+type emailForm struct {
+	Email string `form:"Email"`
+}
+
 func UsersSettingsUpdateName(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 	usr := c.Value("current_user").(*models.User)
-	if err := c.Bind(usr); err != nil {
+	// only the name is taken from the form: binding the user would let
+	// the form set any of its fields.
+	form := new(nameForm)
+	if err := c.Bind(form); err != nil {
 		return errors.WithStack(err)
 	}
+	usr.FullName = form.FullName
 
 	if err := tx.Update(usr); err != nil {
 		return errors.WithStack(err)
@@ -261,24 +413,81 @@ func UsersSettingsUpdateName(c buffalo.Context) error {
 func UsersSettingsUpdateEmail(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 	usr := c.Value("current_user").(*models.User)
-	if err := c.Bind(usr); err != nil {
+	old := usr.Email
+	form := new(emailForm)
+	if err := c.Bind(form); err != nil {
 		return errors.WithStack(err)
 	}
+	usr.Email = strings.ToLower(form.Email)
+	changed := usr.Email != old
+	if changed {
+		usr.EmailVerified = false
+	}
 
 	if err := tx.Update(usr); err != nil {
 		return errors.WithStack(err)
 	}
+	if changed {
+		if err := mailers.SendEmailVerification(c, usr); err != nil {
+			return errors.WithStack(err)
+		}
+		c.Flash().Add("success", "Check your mailbox to confirm your new email address.")
+	}
+	return c.Redirect(302, "/users/settings")
+}
+
+// UsersSettingsResendVerification mails a new verification link to the
+// current user.
+func UsersSettingsResendVerification(c buffalo.Context) error {
+	usr := c.Value("current_user").(*models.User)
+	if usr.EmailVerified {
+		return c.Redirect(302, "/users/settings")
+	}
+	if err := mailers.SendEmailVerification(c, usr); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "A new confirmation link has been sent to your email address.")
 	return c.Redirect(302, "/users/settings")
 }
 
+// UsersVerifyEmail marks the email address of a user as verified.
+func UsersVerifyEmail(c buffalo.Context) error {
+	uid, email, err := models.VerifyEmailToken(c.Param("token"))
+	if err != nil {
+		c.Flash().Add("danger", "This confirmation link is invalid or has expired.")
+		return c.Redirect(302, "/")
+	}
+	tx := c.Value("tx").(*pop.Connection)
+	usr := new(models.User)
+	if err := tx.Find(usr, uid); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			c.Flash().Add("danger", "This confirmation link is invalid or has expired.")
+			return c.Redirect(302, "/")
+		}
+		return errors.WithStack(err)
+	}
+	if !strings.EqualFold(usr.Email, email) {
+		// the address was changed since the link was sent.
+		c.Flash().Add("danger", "This confirmation link is invalid or has expired.")
+		return c.Redirect(302, "/")
+	}
+	usr.EmailVerified = true
+	if err := tx.Update(usr); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Your email address has been confirmed.")
+	return c.Redirect(302, "/")
+}
+
 func UsersSettingsUpdatePassword(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 	usr := c.Value("current_user").(*models.User)
-	if err := c.Bind(usr); err != nil {
+	form := new(passwordForm)
+	if err := c.Bind(form); err != nil {
 		return errors.WithStack(err)
 	}
 
-	pwd, err := bcrypt.GenerateFromPassword([]byte(usr.Password), bcrypt.DefaultCost)
+	pwd, err := bcrypt.GenerateFromPassword([]byte(form.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -288,16 +497,31 @@ func UsersSettingsUpdatePassword(c buffalo.Context) error {
 	if err := tx.Update(usr); err != nil {
 		return errors.WithStack(err)
 	}
+	// log out the other browsers, which may have been opened with the
+	// old password.
+	if sess, ok := c.Value("current_session").(*models.UserSession); ok {
+		if err := models.RevokeUserSessions(tx, usr.ID, sess.ID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	return c.Redirect(302, "/users/settings")
 }
 
 func UsersShow(c buffalo.Context) error {
 	user := &models.User{}
+	tx := c.Value("tx").(*pop.Connection)
+	// users are designated by their username in @mentions.
+	if name := c.Param("username"); name != "" {
+		if err := tx.Where("username = ?", strings.ToLower(name)).First(user); err != nil {
+			return c.Error(404, err)
+		}
+		c.Set("user", user)
+		return c.Render(200, r.HTML("users/show"))
+	}
 	uid := c.Param("uid")
 	if uid == "" {
 		uid = c.Session().Get("current_user_id").(string)
 	}
-	tx := c.Value("tx").(*pop.Connection)
 	if err := tx.Find(user, uid); err != nil {
 		return errors.WithStack(err)
 	}
@@ -306,15 +530,23 @@ func UsersShow(c buffalo.Context) error {
 	return c.Render(200, r.HTML("users/show"))
 }
 
-// AdminRequired requires a user to be logged in and to be an admin before accessing a route.
-func AdminRequired(next buffalo.Handler) buffalo.Handler {
-	return func(c buffalo.Context) error {
-		user, ok := c.Value("current_user").(*models.User)
-		if ok && user.Admin {
-			return next(c)
+// PermissionRequired requires a user to be logged in and to hold the given
+// permission before accessing a route.
+func PermissionRequired(perm string) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			user, ok := c.Value("current_user").(*models.User)
+			if ok && user != nil && user.Can(perm) {
+				forum, ok := c.Value("forum").(*models.Forum)
+				if ok && forum.RequireAdmin2FA && !user.TOTPEnabled {
+					c.Flash().Add("danger", "You must enable two-factor authentication to view that page.")
+					return c.Redirect(302, "/users/settings/two-factor")
+				}
+				return next(c)
+			}
+			c.Flash().Add("danger", "You are not authorized to view that page.")
+			return c.Redirect(302, "/")
 		}
-		c.Flash().Add("danger", "You are not authorized to view that page.")
-		return c.Redirect(302, "/")
 	}
 }
 
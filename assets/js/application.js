@@ -3,5 +3,75 @@ require("popper.js/dist/popper.min.js");
 require("bootstrap/dist/js/bootstrap.min.js");
 
 $(() => {
+	// when quoting a post, only quote the text selected in it, if any.
+	$("a.quote-post").on("click", function(e) {
+		const sel = window.getSelection();
+		if (sel.isCollapsed || !$.contains(document.getElementById("content-" + $(this).data("post")), sel.anchorNode)) {
+			return;
+		}
+		e.preventDefault();
+		window.location = this.href + "&selection=" + encodeURIComponent(sel.toString());
+	});
 
+	// suggest usernames when typing an @mention in a post.
+	$("textarea[name=Content]").each(function() {
+		const area = $(this);
+		const menu = $('<div class="dropdown-menu"></div>').insertAfter(area);
+		const mention = () => {
+			const text = area.val().slice(0, area.prop("selectionStart"));
+			const m = /(^|[^\w@\/.])@([a-z0-9_.-]*)$/.exec(text);
+			return m === null ? null : m[2];
+		};
+		area.on("input", () => {
+			const prefix = mention();
+			if (prefix === null || prefix === "") {
+				menu.removeClass("show");
+				return;
+			}
+			$.getJSON("/users/autocomplete", {q: prefix}, (names) => {
+				menu.empty();
+				names.forEach((name) => {
+					$('<a class="dropdown-item" href="#"></a>').text(name).appendTo(menu).on("click", (e) => {
+						e.preventDefault();
+						const pos = area.prop("selectionStart");
+						const val = area.val();
+						const start = pos - mention().length;
+						area.val(val.slice(0, start) + name + " " + val.slice(pos));
+						area.focus();
+						area.prop("selectionStart", start + name.length + 1);
+						area.prop("selectionEnd", start + name.length + 1);
+						menu.removeClass("show");
+					});
+				});
+				menu.toggleClass("show", names.length > 0);
+			});
+		});
+		area.on("blur", () => setTimeout(() => menu.removeClass("show"), 200));
+	});
+
+	// save the drafts of new posts on the server while they are written.
+	$("form[data-draft]").each(function() {
+		const form = $(this);
+		const status = form.find(".draft-status");
+		let timer = null;
+		const save = () => {
+			timer = null;
+			const data = form.find("[name=authenticity_token], [name=Title], [name=Content]").serialize();
+			$.post(form.data("draft"), data)
+				.done(() => status.text(status.data("saved")))
+				.fail(() => status.text(status.data("failed")));
+		};
+		form.on("input", "[name=Title], [name=Content]", () => {
+			clearTimeout(timer);
+			timer = setTimeout(save, 2000);
+		});
+		form.on("submit", () => clearTimeout(timer));
+	});
+
+	// follow links to posts that were moved to another topic.
+	const post = /^#([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$/i.exec(window.location.hash);
+	const topic = /^\/topics\/detail\/([0-9a-f-]{36})/i.exec(window.location.pathname);
+	if (post !== null && topic !== null && document.getElementById(post[1]) === null) {
+		window.location.replace("/replies/locate/" + post[1] + "?from=" + topic[1]);
+	}
 });
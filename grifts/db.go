@@ -22,6 +22,7 @@ import (
 	"github.com/go-saloon/saloon/actions"
 	"github.com/go-saloon/saloon/models"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/slices"
 	"github.com/markbates/grift/grift"
 	"github.com/pkg/errors"
 )
@@ -60,11 +61,16 @@ var _ = grift.Namespace("db", func() {
 		}
 
 		return models.DB.Transaction(func(tx *pop.Connection) error {
+			role, err := models.FindOrCreateAdminRole(tx)
+			if err != nil {
+				return errors.WithStack(err)
+			}
 			usr := &models.User{
-				Username: "admin",
-				Email:    *mail,
-				Password: *pass,
-				Admin:    true,
+				Username:      "admin",
+				Email:         *mail,
+				Password:      *pass,
+				Roles:         slices.UUID{role.ID},
+				EmailVerified: true,
 			}
 			pwd, err := bcrypt.GenerateFromPassword([]byte(usr.Password), bcrypt.DefaultCost)
 			if err != nil {
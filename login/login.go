@@ -0,0 +1,94 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package login defines the external identity providers users can log in
+// with, in addition to the saloon username and password.
+package login
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+	"sync"
+)
+
+// Identity is the identity of a user, as asserted by a Provider.
+type Identity struct {
+	Provider      string // name of the provider
+	Subject       string // stable identifier of the user at the provider
+	Email         string
+	EmailVerified bool
+	Username      string // preferred username, if any
+	FullName      string
+}
+
+// Provider is an external identity provider.
+type Provider interface {
+	// Name is the short, URL-safe, name of the provider.
+	Name() string
+	// DisplayName is the name displayed on the login page.
+	DisplayName() string
+	// AuthCodeURL returns the URL of the provider's consent page.
+	// state is sent back to the callback as is, verifier is the PKCE
+	// code verifier.
+	AuthCodeURL(ctx context.Context, state, verifier string) (string, error)
+	// Exchange converts an authorization code into the identity of the user.
+	Exchange(ctx context.Context, code, verifier string) (*Identity, error)
+}
+
+var registry = struct {
+	sync.RWMutex
+	providers map[string]Provider
+}{
+	providers: make(map[string]Provider),
+}
+
+// Register makes a provider available to log in.
+// Register panics if a provider with the same name was already registered.
+func Register(p Provider) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.providers[p.Name()]; dup {
+		panic("login: provider " + p.Name() + " already registered")
+	}
+	registry.providers[p.Name()] = p
+}
+
+// Lookup returns the provider registered with the given name.
+func Lookup(name string) (Provider, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	p, ok := registry.providers[name]
+	return p, ok
+}
+
+// Providers returns all the registered providers, sorted by name.
+func Providers() []Provider {
+	registry.RLock()
+	defer registry.RUnlock()
+	ps := make([]Provider, 0, len(registry.providers))
+	for _, p := range registry.providers {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name() < ps[j].Name() })
+	return ps
+}
+
+// NewRandom returns a random URL-safe string, suitable as an OAuth2 state
+// or as a PKCE code verifier.
+func NewRandom() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Challenge returns the S256 PKCE code challenge of a code verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package login
+
+import (
+	"context"
+	"sync"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig describes an OpenID Connect provider.
+type OIDCConfig struct {
+	Name         string // short name of the provider, used in URLs
+	DisplayName  string
+	Issuer       string // issuer URL, used for discovery
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // URL of the saloon callback handler
+	Scopes       []string // additional scopes, "openid" is always requested
+}
+
+// oidcProvider implements the OpenID Connect authorization code flow,
+// with PKCE.
+type oidcProvider struct {
+	cfg OIDCConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC returns a Provider for the given OpenID Connect issuer.
+// Discovery is performed on first use.
+func NewOIDC(cfg OIDCConfig) Provider {
+	return &oidcProvider{cfg: cfg}
+}
+
+func (p *oidcProvider) Name() string        { return p.cfg.Name }
+func (p *oidcProvider) DisplayName() string { return p.cfg.DisplayName }
+
+// discover fetches the configuration of the issuer.
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "login: could not discover OIDC issuer %q", p.cfg.Issuer)
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID, "profile", "email"}, p.cfg.Scopes...),
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	return p.oauth, p.verifier, nil
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, verifier string) (string, error) {
+	oauth, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oauth.AuthCodeURL(
+		state,
+		oauth2.SetAuthURLParam("code_challenge", Challenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, verifier string) (*Identity, error) {
+	oauth, idv, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, errors.Wrap(err, "login: could not exchange authorization code")
+	}
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("login: no id_token in token response")
+	}
+	idt, err := idv.Verify(ctx, raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "login: invalid id_token")
+	}
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := idt.Claims(&claims); err != nil {
+		return nil, errors.Wrap(err, "login: invalid id_token claims")
+	}
+	return &Identity{
+		Provider:      p.cfg.Name,
+		Subject:       idt.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      claims.PreferredUsername,
+		FullName:      claims.Name,
+	}, nil
+}
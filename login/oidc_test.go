@@ -0,0 +1,193 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package login
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// fakeIdP is a minimal OpenID Connect provider, standing in for a real one.
+type fakeIdP struct {
+	srv      *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	challenge string // PKCE challenge received on the authorization endpoint
+	code      string // authorization code handed out
+	claims    map[string]interface{}
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{
+		key:      key,
+		clientID: "saloon",
+		code:     "the-code",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.keys)
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *fakeIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	url := idp.srv.URL
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                url,
+		"authorization_endpoint":                url + "/auth",
+		"token_endpoint":                        url + "/token",
+		"jwks_uri":                              url + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *fakeIdP) keys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{
+			Key:       &idp.key.PublicKey,
+			KeyID:     "k1",
+			Algorithm: "RS256",
+			Use:       "sig",
+		}},
+	})
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code") != idp.code {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	if Challenge(r.Form.Get("code_verifier")) != idp.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss": idp.srv.URL,
+		"aud": idp.clientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: idp.key},
+		(&jose.SignerOptions{}).WithHeader("kid", "k1"),
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	raw, err := jws.CompactSerialize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     raw,
+	})
+}
+
+func TestOIDC(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.srv.Close()
+	idp.claims = map[string]interface{}{
+		"sub":                "alice-at-idp",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"name":               "Alice",
+	}
+
+	p := NewOIDC(OIDCConfig{
+		Name:        "test",
+		DisplayName: "Test IdP",
+		Issuer:      idp.srv.URL,
+		ClientID:    idp.clientID,
+		RedirectURL: "http://saloon.example.com/users/auth/test/callback",
+	})
+
+	ctx := context.Background()
+	verifier, err := NewRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := p.AuthCodeURL(ctx, "the-state", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	for k, want := range map[string]string{
+		"state":                 "the-state",
+		"client_id":             idp.clientID,
+		"code_challenge":        Challenge(verifier),
+		"code_challenge_method": "S256",
+		"response_type":         "code",
+	} {
+		if got := q.Get(k); got != want {
+			t.Fatalf("invalid %s parameter: got=%q, want=%q", k, got, want)
+		}
+	}
+	idp.challenge = q.Get("code_challenge")
+
+	_, err = p.Exchange(ctx, idp.code, "wrong-verifier")
+	if err == nil {
+		t.Fatalf("expected an error with an invalid PKCE verifier")
+	}
+
+	id, err := p.Exchange(ctx, idp.code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{
+		Provider:      "test",
+		Subject:       "alice-at-idp",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Username:      "alice",
+		FullName:      "Alice",
+	}
+	if *id != want {
+		t.Fatalf("invalid identity:\ngot= %#v\nwant=%#v", *id, want)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailers
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/pkg/errors"
+)
+
+// SendLockout warns a user that the account was locked out after too many
+// failed login attempts.
+func SendLockout(c buffalo.Context, usr *models.User) error {
+	m := mail.NewMessage()
+	m.SetHeader("X-Auto-Response-Suppress", "All")
+
+	m.Subject = notify.SubjectHdr + " Account locked"
+	m.From = notify.From
+	m.To = []string{usr.Email}
+
+	data := map[string]interface{}{
+		"username": usr.Username,
+		"attempts": models.LoginLockoutAttempts,
+		"duration": models.LoginLockoutDuration.String(),
+		"link":     notify.ListArchive + "/users/forgot-password",
+	}
+
+	err := m.AddBodies(
+		data,
+		r.Plain("mail/lockout.txt"),
+		r.HTML("mail/lockout.html"),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = smtp.Send(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
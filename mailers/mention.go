@@ -0,0 +1,57 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailers
+
+import (
+	"fmt"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// SendMention notifies users that they were mentioned in a post of a
+// topic. post is the ID of the reply, or uuid.Nil for the topic itself.
+func SendMention(c buffalo.Context, topic *models.Topic, post uuid.UUID, author *models.User, content string, recpts []models.User) error {
+	m := mail.NewMessage()
+	m.SetHeader("X-Auto-Response-Suppress", "All")
+
+	m.Subject = fmt.Sprintf("%s %s mentioned you in %s", notify.SubjectHdr, author.Username, topic.Title)
+	m.From = fmt.Sprintf("%s <%s>", author.Username, notify.From)
+	m.To = nil
+	m.Bcc = nil
+	for _, usr := range recpts {
+		m.Bcc = append(m.Bcc, usr.Email)
+	}
+
+	visit := notify.ListArchive + "/topics/detail/" + topic.ID.String()
+	if post != uuid.Nil {
+		visit += "#" + post.String()
+	}
+	data := map[string]interface{}{
+		"author":  author.Username,
+		"title":   topic.Title,
+		"content": content,
+		"visit":   visit,
+	}
+
+	err := m.AddBodies(
+		data,
+		r.Plain("mail/mention.txt"),
+		r.HTML("mail/mention.html"),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = smtp.Send(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailers
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/pkg/errors"
+)
+
+// SendPasswordReset mails a password reset link to the given user.
+func SendPasswordReset(c buffalo.Context, usr *models.User, token string) error {
+	m := mail.NewMessage()
+	m.SetHeader("X-Auto-Response-Suppress", "All")
+
+	m.Subject = notify.SubjectHdr + " Password reset"
+	m.From = notify.From
+	m.To = []string{usr.Email}
+
+	data := map[string]interface{}{
+		"username": usr.Username,
+		"link":     notify.ListArchive + "/users/reset-password/" + token,
+		"validity": models.PasswordResetTTL.String(),
+	}
+
+	err := m.AddBodies(
+		data,
+		r.Plain("mail/password_reset.txt"),
+		r.HTML("mail/password_reset.html"),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = smtp.Send(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailers
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/pkg/errors"
+)
+
+// SendEmailVerification mails a link to confirm the email address of the
+// given user.
+func SendEmailVerification(c buffalo.Context, usr *models.User) error {
+	m := mail.NewMessage()
+	m.SetHeader("X-Auto-Response-Suppress", "All")
+
+	m.Subject = notify.SubjectHdr + " Confirm your email address"
+	m.From = notify.From
+	m.To = []string{usr.Email}
+
+	data := map[string]interface{}{
+		"username": usr.Username,
+		"link":     notify.ListArchive + "/users/verify-email/" + usr.EmailVerificationToken(),
+		"validity": models.EmailVerificationTTL.String(),
+	}
+
+	err := m.AddBodies(
+		data,
+		r.Plain("mail/verify_email.txt"),
+		r.HTML("mail/verify_email.html"),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = smtp.Send(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// Scopes of personal access tokens.
+const (
+	ScopeRead  = "read"  // only safe (GET, HEAD, OPTIONS) requests
+	ScopeWrite = "write" // all requests, without the permissions of the user's roles
+	ScopeAdmin = "admin" // all requests, with the permissions of the user's roles
+)
+
+// AccessTokenPrefix starts all personal access tokens, so that they can be
+// easily recognized.
+const AccessTokenPrefix = "saloon_"
+
+// AccessToken is a personal access token, used by scripts to authenticate
+// as a user.
+// Only the hash of the token is stored.
+type AccessToken struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name" form:"Name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	Scope      string     `json:"scope" db:"scope" form:"Scope"`
+	LastUsedAt nulls.Time `json:"last_used_at" db:"last_used_at"`
+}
+
+type AccessTokens []AccessToken
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (a *AccessToken) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: a.Name, Name: "Name"},
+		&validators.StringInclusion{Field: a.Scope, Name: "Scope", List: []string{ScopeRead, ScopeWrite, ScopeAdmin}},
+	), nil
+}
+
+// Allows reports whether the token may be used for a request with the
+// given HTTP method.
+func (a AccessToken) Allows(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return a.Scope == ScopeWrite || a.Scope == ScopeAdmin
+}
+
+// Create generates a new token for the user, validates and stores it.
+// The clear-text token is returned and can not be retrieved afterwards.
+func (a *AccessToken) Create(tx *pop.Connection, usr *User) (string, *validate.Errors, error) {
+	if a.Scope == ScopeAdmin && !usr.Privileged() {
+		verrs := validate.NewErrors()
+		verrs.Add("Scope", "Only users holding a role can create admin tokens.")
+		return "", verrs, nil
+	}
+	tok, err := newToken()
+	if err != nil {
+		return "", validate.NewErrors(), errors.WithStack(err)
+	}
+	tok = AccessTokenPrefix + tok
+	a.UserID = usr.ID
+	a.Prefix = tok[:len(AccessTokenPrefix)+6]
+	a.TokenHash = hashToken(tok)
+	verrs, err := tx.ValidateAndCreate(a)
+	if err != nil || verrs.HasAny() {
+		return "", verrs, err
+	}
+	return tok, verrs, nil
+}
+
+// FindAccessToken retrieves the access token matching the given clear-text
+// token, and records its use.
+func FindAccessToken(tx *pop.Connection, tok string) (*AccessToken, error) {
+	a := new(AccessToken)
+	err := tx.Where("token_hash = ?", hashToken(tok)).First(a)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, errors.WithStack(err)
+	}
+	a.LastUsedAt = nulls.NewTime(time.Now().UTC())
+	if err := tx.Update(a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"strings"
+
+	"github.com/go-saloon/saloon/models"
+)
+
+func (ms *ModelSuite) Test_AccessToken() {
+	u := &models.User{
+		Username:        "usr1",
+		Email:           "user@example.com",
+		Password:        "password",
+		PasswordConfirm: "password",
+	}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	at := &models.AccessToken{Name: "bot", Scope: models.ScopeAdmin}
+	_, verrs, err = at.Create(ms.DB, u)
+	ms.NoError(err)
+	ms.True(verrs.HasAny(), "only admins can create admin tokens")
+
+	at = &models.AccessToken{Name: "bot", Scope: models.ScopeRead}
+	tok, verrs, err := at.Create(ms.DB, u)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.True(strings.HasPrefix(tok, models.AccessTokenPrefix))
+	ms.True(strings.HasPrefix(tok, at.Prefix))
+	ms.True(at.Allows("GET"))
+	ms.False(at.Allows("POST"))
+
+	got, err := models.FindAccessToken(ms.DB, tok)
+	ms.NoError(err)
+	ms.Equal(at.ID, got.ID)
+	ms.True(got.LastUsedAt.Valid)
+
+	_, err = models.FindAccessToken(ms.DB, tok+"x")
+	ms.Equal(models.ErrInvalidToken, err)
+}
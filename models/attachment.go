@@ -0,0 +1,145 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// MaxAttachmentSize is the maximum size of an attached file, in bytes.
+const MaxAttachmentSize = 8 << 20
+
+// MaxAttachments is the maximum number of files attached to a post.
+const MaxAttachments = 10
+
+// AttachmentTypes are the MIME types of the files that may be attached
+// to posts, as detected from their content.
+var AttachmentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"text/plain", // logs and patches
+	"application/pdf",
+	"application/zip",
+	"application/x-gzip",
+}
+
+// Attachment is a file attached to a topic or to a reply.
+// Its content is kept in a storage, under Key.
+type Attachment struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	PostID      uuid.UUID `json:"post_id" db:"post_id"`
+	TopicID     uuid.UUID `json:"topic_id" db:"topic_id"`
+	AuthorID    uuid.UUID `json:"author_id" db:"author_id"`
+	Name        string    `json:"name" db:"name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	Thumbnail   bool      `json:"thumbnail" db:"thumbnail"` // whether a thumbnail of the image was stored
+}
+
+type Attachments []Attachment
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (a *Attachment) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: a.Name, Name: "Name"},
+		&AttachmentIsValid{Name: "Attachment", Field: a},
+	), nil
+}
+
+// AttachmentIsValid checks the size and the type of an attached file.
+type AttachmentIsValid struct {
+	Name  string
+	Field *Attachment
+}
+
+// IsValid adds an error if the file is empty, too large, or of a type
+// that may not be attached.
+func (v *AttachmentIsValid) IsValid(errors *validate.Errors) {
+	a := v.Field
+	switch {
+	case a.Size == 0:
+		errors.Add(validators.GenerateKey(v.Name), fmt.Sprintf("The file %q is empty.", a.Name))
+	case a.Size > MaxAttachmentSize:
+		errors.Add(validators.GenerateKey(v.Name), fmt.Sprintf("The file %q is larger than %s.", a.Name, FormatSize(MaxAttachmentSize)))
+	case !AttachmentTypeAllowed(a.ContentType):
+		errors.Add(validators.GenerateKey(v.Name), fmt.Sprintf("Files of type %s, such as %q, can not be attached.", a.ContentType, a.Name))
+	}
+}
+
+// AttachmentTypeAllowed reports whether files of the given MIME type may
+// be attached. Parameters of the type, such as the charset, are ignored.
+func AttachmentTypeAllowed(ctype string) bool {
+	t, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range AttachmentTypes {
+		if t == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the storage key of the file.
+func (a Attachment) Key() string { return a.ID.String() }
+
+// ThumbnailKey returns the storage key of the thumbnail of the file.
+func (a Attachment) ThumbnailKey() string { return a.ID.String() + ".thumb" }
+
+// IsImage reports whether the file is an image.
+func (a Attachment) IsImage() bool { return strings.HasPrefix(a.ContentType, "image/") }
+
+// Inline reports whether the file may be displayed by browsers, rather
+// than downloaded.
+func (a Attachment) Inline() bool {
+	return a.IsImage() || strings.HasPrefix(a.ContentType, "text/plain")
+}
+
+// HumanSize returns the size of the file, for display.
+func (a Attachment) HumanSize() string { return FormatSize(a.Size) }
+
+// FormatSize formats a size in bytes, for display.
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f kB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// ByPost groups the attachments by the ID of their post.
+func (a Attachments) ByPost() map[string]Attachments {
+	posts := make(map[string]Attachments)
+	for _, att := range a {
+		posts[att.PostID.String()] = append(posts[att.PostID.String()], att)
+	}
+	return posts
+}
+
+// PostAttachments returns the files attached to a topic or a reply, oldest
+// first.
+func PostAttachments(tx *pop.Connection, post uuid.UUID) (Attachments, error) {
+	atts := Attachments{}
+	if err := tx.Where("post_id = ?", post).Order("created_at asc").All(&atts); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return atts, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_Attachment_Validate() {
+	att := &models.Attachment{Name: "build.log", ContentType: "text/plain; charset=utf-8", Size: 1024}
+	verrs, err := att.Validate(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	att.Size = models.MaxAttachmentSize + 1
+	verrs, err = att.Validate(ms.DB)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+
+	att.Size = 1024
+	att.ContentType = "application/octet-stream"
+	verrs, err = att.Validate(ms.DB)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+}
+
+func (ms *ModelSuite) Test_FormatSize() {
+	ms.Equal("512 B", models.FormatSize(512))
+	ms.Equal("1.5 kB", models.FormatSize(1536))
+	ms.Equal("8.0 MB", models.FormatSize(models.MaxAttachmentSize))
+}
+
+func (ms *ModelSuite) Test_PostAttachments() {
+	topic := uuid.Must(uuid.NewV4())
+	reply := uuid.Must(uuid.NewV4())
+	for _, post := range []uuid.UUID{topic, reply, reply} {
+		att := &models.Attachment{
+			TopicID:     topic,
+			PostID:      post,
+			AuthorID:    uuid.Must(uuid.NewV4()),
+			Name:        "screenshot.png",
+			ContentType: "image/png",
+			Size:        2048,
+		}
+		ms.NoError(ms.DB.Create(att))
+	}
+	atts, err := models.PostAttachments(ms.DB, reply)
+	ms.NoError(err)
+	ms.Len(atts, 2)
+	ms.True(atts[0].IsImage())
+
+	all := models.Attachments{}
+	ms.NoError(ms.DB.Where("topic_id = ?", topic).All(&all))
+	posts := all.ByPost()
+	ms.Len(posts[topic.String()], 1)
+	ms.Len(posts[reply.String()], 2)
+}
@@ -6,6 +6,7 @@ package models
 
 import (
 	"encoding/json"
+	"sort"
 	"time"
 
 	"github.com/gobuffalo/pop"
@@ -24,6 +25,9 @@ type Category struct {
 	Description    nulls.String `json:"description" db:"description"`
 	ParentCategory nulls.UUID   `json:"parent_category" db:"parent_category"`
 	Subscribers    slices.UUID  `json:"subscribers" db:"subscribers"`
+	Moderators     slices.UUID  `json:"moderators" db:"moderators"`
+	Position       int          `json:"position" db:"position"`
+	Archived       bool         `json:"archived" db:"archived"`
 }
 
 // String is not required by pop and may be deleted
@@ -59,6 +63,33 @@ func (c *Category) RemoveSubscriber(id uuid.UUID) {
 	c.Subscribers = subs
 }
 
+// HasModerator reports whether the given user moderates the category.
+func (c Category) HasModerator(id uuid.UUID) bool {
+	for _, mod := range c.Moderators {
+		if mod == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Category) AddModerator(id uuid.UUID) {
+	if c.HasModerator(id) {
+		return
+	}
+	c.Moderators = append(c.Moderators, id)
+}
+
+func (c *Category) RemoveModerator(id uuid.UUID) {
+	mods := make(slices.UUID, 0, len(c.Moderators))
+	for _, mod := range c.Moderators {
+		if mod != id {
+			mods = append(mods, mod)
+		}
+	}
+	c.Moderators = mods
+}
+
 // Categories is not required by pop and may be deleted
 type Categories []Category
 
@@ -70,21 +101,152 @@ func (c Categories) String() string {
 
 func (p Categories) Len() int      { return len(p) }
 func (p Categories) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// Less orders categories by position, then by title.
 func (p Categories) Less(i, j int) bool {
+	if p[i].Position != p[j].Position {
+		return p[i].Position < p[j].Position
+	}
 	if p[i].Title == p[j].Title {
 		return p[i].ID.String() < p[j].ID.String()
 	}
 	return p[i].Title < p[j].Title
 }
 
+// CategoryNode is a category placed in the category tree.
+type CategoryNode struct {
+	Category
+	Depth int
+}
+
+// find returns the category with the given id, or nil.
+func (p Categories) find(id uuid.UUID) *Category {
+	for i := range p {
+		if p[i].ID == id {
+			return &p[i]
+		}
+	}
+	return nil
+}
+
+// Tree returns the categories in depth-first order, each category being
+// followed by its subcategories.
+// Categories whose parent is not in the list are treated as roots.
+func (p Categories) Tree() []CategoryNode {
+	children := make(map[uuid.UUID]Categories)
+	var roots Categories
+	for _, c := range p {
+		if c.ParentCategory.Valid && c.ParentCategory.UUID != c.ID && p.find(c.ParentCategory.UUID) != nil {
+			children[c.ParentCategory.UUID] = append(children[c.ParentCategory.UUID], c)
+			continue
+		}
+		roots = append(roots, c)
+	}
+
+	tree := make([]CategoryNode, 0, len(p))
+	seen := make(map[uuid.UUID]bool, len(p))
+	var walk func(cs Categories, depth int)
+	walk = func(cs Categories, depth int) {
+		sort.Sort(cs)
+		for _, c := range cs {
+			if seen[c.ID] {
+				continue
+			}
+			seen[c.ID] = true
+			tree = append(tree, CategoryNode{Category: c, Depth: depth})
+			walk(children[c.ID], depth+1)
+		}
+	}
+	walk(roots, 0)
+	return tree
+}
+
+// Ancestors returns the ancestors of the category with the given id,
+// starting from the root.
+func (p Categories) Ancestors(id uuid.UUID) Categories {
+	var ancs Categories
+	seen := map[uuid.UUID]bool{id: true}
+	c := p.find(id)
+	for c != nil && c.ParentCategory.Valid && !seen[c.ParentCategory.UUID] {
+		seen[c.ParentCategory.UUID] = true
+		c = p.find(c.ParentCategory.UUID)
+		if c == nil {
+			break
+		}
+		ancs = append(Categories{*c}, ancs...)
+	}
+	return ancs
+}
+
+// Subscribers returns the users subscribed to the category with the given
+// id, either directly or through one of its ancestors.
+func (p Categories) Subscribers(id uuid.UUID) slices.UUID {
+	var subs slices.UUID
+	if c := p.find(id); c != nil {
+		subs = append(subs, c.Subscribers...)
+	}
+	for _, c := range p.Ancestors(id) {
+		subs = append(subs, c.Subscribers...)
+	}
+	return subs
+}
+
+// InheritsSubscription reports whether the user is subscribed to the
+// category with the given id through one of its ancestors.
+func (p Categories) InheritsSubscription(uid, id uuid.UUID) bool {
+	for _, c := range p.Ancestors(id) {
+		for _, sub := range c.Subscribers {
+			if sub == uid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
 // This method is not required and may be deleted.
 func (c *Category) Validate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.Validate(
 		&validators.StringIsPresent{Field: c.Title, Name: "Title"},
+		&CategoryParentIsValid{Name: "ParentCategory", Field: c.ParentCategory, ID: c.ID, tx: tx},
 	), nil
 }
 
+// CategoryParentIsValid checks that the parent of a category exists and
+// that the category is not one of its own ancestors.
+type CategoryParentIsValid struct {
+	Name  string
+	Field nulls.UUID
+	ID    uuid.UUID
+	tx    *pop.Connection
+}
+
+// IsValid performs the validation check for category parents
+func (v *CategoryParentIsValid) IsValid(errors *validate.Errors) {
+	if !v.Field.Valid {
+		return
+	}
+	seen := make(map[uuid.UUID]bool)
+	id := v.Field.UUID
+	for !seen[id] {
+		if id == v.ID {
+			errors.Add(validators.GenerateKey(v.Name), "A category can not be its own subcategory.")
+			return
+		}
+		seen[id] = true
+		parent := new(Category)
+		if err := v.tx.Find(parent, id); err != nil {
+			errors.Add(validators.GenerateKey(v.Name), "The parent category does not exist.")
+			return
+		}
+		if !parent.ParentCategory.Valid {
+			return
+		}
+		id = parent.ParentCategory.UUID
+	}
+}
+
 // ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
 // This method is not required and may be deleted.
 func (c *Category) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
@@ -0,0 +1,103 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"sort"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/pop/slices"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_Category_Moderators() {
+	mod := models.User{ID: uuid.Must(uuid.NewV4())}
+	author := uuid.Must(uuid.NewV4())
+
+	cat := &models.Category{Title: "cat"}
+	other := &models.Category{Title: "other"}
+	ms.False(mod.Moderates(cat))
+
+	cat.AddModerator(mod.ID)
+	cat.AddModerator(mod.ID)
+	ms.Len(cat.Moderators, 1)
+	ms.True(mod.Moderates(cat))
+	ms.True(mod.CanEdit(author, cat))
+	ms.True(mod.CanDelete(author, cat))
+	ms.False(mod.Moderates(other))
+	ms.False(mod.CanEdit(author, other))
+	ms.False(mod.CanDelete(author, other))
+
+	cat.RemoveModerator(mod.ID)
+	ms.False(mod.Moderates(cat))
+}
+
+func (ms *ModelSuite) Test_Category_Tree() {
+	usr := uuid.Must(uuid.NewV4())
+	root := models.Category{ID: uuid.Must(uuid.NewV4()), Title: "root", Subscribers: slices.UUID{usr}}
+	other := models.Category{ID: uuid.Must(uuid.NewV4()), Title: "other"}
+	child := models.Category{ID: uuid.Must(uuid.NewV4()), Title: "child", ParentCategory: nulls.NewUUID(root.ID)}
+	leaf := models.Category{ID: uuid.Must(uuid.NewV4()), Title: "leaf", ParentCategory: nulls.NewUUID(child.ID)}
+	cats := models.Categories{leaf, other, child, root}
+
+	var titles []string
+	var depths []int
+	for _, n := range cats.Tree() {
+		titles = append(titles, n.Title)
+		depths = append(depths, n.Depth)
+	}
+	ms.Equal([]string{"other", "root", "child", "leaf"}, titles)
+	ms.Equal([]int{0, 0, 1, 2}, depths)
+
+	ancs := cats.Ancestors(leaf.ID)
+	ms.Len(ancs, 2)
+	ms.Equal(root.ID, ancs[0].ID)
+	ms.Equal(child.ID, ancs[1].ID)
+	ms.Empty(cats.Ancestors(root.ID))
+
+	ms.True(cats.InheritsSubscription(usr, leaf.ID))
+	ms.False(cats.InheritsSubscription(usr, root.ID))
+	ms.False(cats.InheritsSubscription(usr, other.ID))
+	ms.Equal(slices.UUID{usr}, cats.Subscribers(leaf.ID))
+}
+
+func (ms *ModelSuite) Test_Category_ValidateParent() {
+	root := &models.Category{Title: "root"}
+	ms.NoError(ms.DB.Create(root))
+	child := &models.Category{Title: "child", ParentCategory: nulls.NewUUID(root.ID)}
+	verrs, err := ms.DB.ValidateAndCreate(child)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	root.ParentCategory = nulls.NewUUID(child.ID)
+	verrs, err = ms.DB.ValidateAndUpdate(root)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+
+	root.ParentCategory = nulls.NewUUID(root.ID)
+	verrs, err = ms.DB.ValidateAndUpdate(root)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+
+	orphan := &models.Category{Title: "orphan", ParentCategory: nulls.NewUUID(uuid.Must(uuid.NewV4()))}
+	verrs, err = ms.DB.ValidateAndCreate(orphan)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+}
+
+func (ms *ModelSuite) Test_Category_Position() {
+	cats := models.Categories{
+		{Title: "a", Position: 2},
+		{Title: "c", Position: 1},
+		{Title: "b", Position: 1},
+	}
+	sort.Sort(cats)
+	var titles []string
+	for _, c := range cats {
+		titles = append(titles, c.Title)
+	}
+	ms.Equal([]string{"b", "c", "a"}, titles)
+}
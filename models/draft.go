@@ -0,0 +1,93 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Draft is a topic or a reply being written by a user, saved as the user
+// types. A user has at most one draft per context: one for each category
+// a topic is written in, and one for each topic a reply is written to.
+type Draft struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Context    string     `json:"context" db:"context"`         // see TopicDraftContext and ReplyDraftContext
+	CategoryID nulls.UUID `json:"category_id" db:"category_id"` // the category of a new topic
+	TopicID    nulls.UUID `json:"topic_id" db:"topic_id"`       // the topic of a new reply
+	Title      string     `json:"title" db:"title"`
+	Content    string     `json:"content" db:"content"`
+
+	Category *Category `json:"-" db:"-"`
+	Topic    *Topic    `json:"-" db:"-"`
+}
+
+type Drafts []Draft
+
+// TopicDraftContext returns the context of the draft of a new topic in
+// the category cid.
+func TopicDraftContext(cid uuid.UUID) string { return "topic:" + cid.String() }
+
+// ReplyDraftContext returns the context of the draft of a reply to the
+// topic tid.
+func ReplyDraftContext(tid uuid.UUID) string { return "reply:" + tid.String() }
+
+// IsReply reports whether the draft is the draft of a reply.
+func (d Draft) IsReply() bool { return d.TopicID.Valid }
+
+// Orphan reports whether the category or the topic of the draft was not
+// loaded, because it no longer exists.
+func (d Draft) Orphan() bool { return d.Category == nil && d.Topic == nil }
+
+// Empty reports whether nothing was written in the draft.
+func (d Draft) Empty() bool {
+	return strings.TrimSpace(d.Title) == "" && strings.TrimSpace(d.Content) == ""
+}
+
+// FindDraft returns the draft of the user uid in a context, or nil if
+// there is none.
+func FindDraft(tx *pop.Connection, uid uuid.UUID, context string) (*Draft, error) {
+	draft := new(Draft)
+	err := tx.Where("user_id = ? AND context = ?", uid, context).First(draft)
+	switch {
+	case errors.Cause(err) == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.WithStack(err)
+	}
+	return draft, nil
+}
+
+// SaveDraft saves a draft, replacing the previous draft of its user in
+// the same context. Empty drafts are deleted instead.
+func SaveDraft(tx *pop.Connection, draft *Draft) error {
+	prev, err := FindDraft(tx, draft.UserID, draft.Context)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	switch {
+	case draft.Empty():
+		return DeleteDraft(tx, draft.UserID, draft.Context)
+	case prev == nil:
+		return errors.WithStack(tx.Create(draft))
+	}
+	draft.ID, draft.CreatedAt = prev.ID, prev.CreatedAt
+	return errors.WithStack(tx.Update(draft))
+}
+
+// DeleteDraft deletes the draft of the user uid in a context, if any.
+func DeleteDraft(tx *pop.Connection, uid uuid.UUID, context string) error {
+	err := tx.RawQuery("DELETE FROM drafts WHERE user_id = ? AND context = ?", uid, context).Exec()
+	return errors.WithStack(err)
+}
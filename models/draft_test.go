@@ -0,0 +1,52 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_SaveDraft() {
+	usr := uuid.Must(uuid.NewV4())
+	tid := uuid.Must(uuid.NewV4())
+	ctx := models.ReplyDraftContext(tid)
+
+	draft := &models.Draft{UserID: usr, Context: ctx, TopicID: nulls.NewUUID(tid), Content: "first"}
+	ms.NoError(models.SaveDraft(ms.DB, draft))
+	draft = &models.Draft{UserID: usr, Context: ctx, TopicID: nulls.NewUUID(tid), Content: "second"}
+	ms.NoError(models.SaveDraft(ms.DB, draft))
+
+	found, err := models.FindDraft(ms.DB, usr, ctx)
+	ms.NoError(err)
+	ms.Equal("second", found.Content)
+	ms.True(found.IsReply())
+	count, err := ms.DB.Where("user_id = ?", usr).Count(&models.Draft{})
+	ms.NoError(err)
+	ms.Equal(1, count)
+
+	// saving an empty draft deletes it.
+	ms.NoError(models.SaveDraft(ms.DB, &models.Draft{UserID: usr, Context: ctx, Content: "  "}))
+	found, err = models.FindDraft(ms.DB, usr, ctx)
+	ms.NoError(err)
+	ms.Nil(found)
+}
+
+func (ms *ModelSuite) Test_DeleteDraft() {
+	usr := uuid.Must(uuid.NewV4())
+	cid := uuid.Must(uuid.NewV4())
+	ctx := models.TopicDraftContext(cid)
+	ms.NoError(models.SaveDraft(ms.DB, &models.Draft{UserID: usr, Context: ctx, CategoryID: nulls.NewUUID(cid), Title: "title"}))
+	ms.NoError(models.SaveDraft(ms.DB, &models.Draft{UserID: uuid.Must(uuid.NewV4()), Context: ctx, Title: "other"}))
+
+	ms.NoError(models.DeleteDraft(ms.DB, usr, ctx))
+	found, err := models.FindDraft(ms.DB, usr, ctx)
+	ms.NoError(err)
+	ms.Nil(found)
+	count, err := ms.DB.Where("context = ?", ctx).Count(&models.Draft{})
+	ms.NoError(err)
+	ms.Equal(1, count)
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/uuid"
+)
+
+// EmailVerificationTTL is how long an email verification link stays valid.
+const EmailVerificationTTL = 72 * time.Hour
+
+// signingKey is used to sign the links mailed to users.
+var signingKey []byte
+
+func init() {
+	key := envy.Get("SESSION_SECRET", "")
+	if key == "" {
+		log.Printf("SESSION_SECRET not set: mailed links will not survive a restart")
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("could not generate signing key: %v", err)
+		}
+		key = string(buf)
+	}
+	signingKey = []byte(key)
+}
+
+// EmailVerificationToken returns a signed token attesting that the user
+// owns its current email address.
+func (u User) EmailVerificationToken() string {
+	exp := time.Now().UTC().Add(EmailVerificationTTL).Unix()
+	msg := strings.Join([]string{
+		u.ID.String(),
+		u.Email,
+		strconv.FormatInt(exp, 10),
+	}, "|")
+	return signToken(msg)
+}
+
+// VerifyEmailToken checks the given token and returns the id of the user
+// and the email address it attests.
+func VerifyEmailToken(tok string) (uuid.UUID, string, error) {
+	msg, ok := checkToken(tok)
+	if !ok {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	toks := strings.SplitN(msg, "|", 3)
+	if len(toks) != 3 {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	id, err := uuid.FromString(toks[0])
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	exp, err := strconv.ParseInt(toks[2], 10, 64)
+	if err != nil || time.Now().UTC().Unix() > exp {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	return id, toks[1], nil
+}
+
+// signToken encodes msg together with its HMAC.
+func signToken(msg string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(msg))
+	return base64.RawURLEncoding.EncodeToString([]byte(msg)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkToken verifies the HMAC of a token created by signToken and returns
+// the signed message.
+func checkToken(tok string) (string, bool) {
+	i := strings.Index(tok, ".")
+	if i < 0 {
+		return "", false
+	}
+	msg, err := base64.RawURLEncoding.DecodeString(tok[:i])
+	if err != nil {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(tok[i+1:])
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write(msg)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", false
+	}
+	return string(msg), true
+}
@@ -0,0 +1,33 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_EmailVerificationToken() {
+	u := models.User{
+		ID:    uuid.Must(uuid.NewV4()),
+		Email: "user@example.com",
+	}
+
+	tok := u.EmailVerificationToken()
+	id, email, err := models.VerifyEmailToken(tok)
+	ms.NoError(err)
+	ms.Equal(u.ID, id)
+	ms.Equal(u.Email, email)
+
+	for _, tok := range []string{
+		"",
+		"garbage",
+		tok[:len(tok)-2],
+		"x" + tok,
+	} {
+		_, _, err = models.VerifyEmailToken(tok)
+		ms.Equal(models.ErrInvalidToken, err, "token %q", tok)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/slices"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
@@ -22,6 +23,18 @@ type Forum struct {
 	Title       string    `json:"title" db:"title"`
 	Description string    `json:"description" db:"description"`
 	Logo        []byte    `json:"logo" db:"logo"`
+
+	// RequireAdmin2FA forbids admin pages to admins that did not enable
+	// two-factor authentication.
+	RequireAdmin2FA bool `json:"require_admin_2fa" db:"require_admin_2fa"`
+
+	// Reactions are the reactions users may add to posts.
+	// DefaultReactions are used when empty.
+	Reactions slices.String `json:"reactions" db:"reactions"`
+
+	// Tags are the tags topics may be tagged with.
+	// Tags are free when empty.
+	Tags slices.String `json:"tags" db:"tags"`
 }
 
 // String is not required by pop and may be deleted
@@ -0,0 +1,176 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Login throttling parameters.
+// Once the free attempts are exhausted, each failed login doubles the
+// time to wait before the next attempt, up to loginMaxBackoff.
+const (
+	loginUserFreeAttempts = 3
+	loginIPFreeAttempts   = 10 // addresses may be shared by many users
+	loginMaxBackoff       = 15 * time.Minute
+	loginFailureWindow    = 24 * time.Hour // failures older than this are forgotten
+
+	// LoginLockoutAttempts is the number of failures after which an
+	// account is locked out for LoginLockoutDuration.
+	LoginLockoutAttempts = 10
+	LoginLockoutDuration = time.Hour
+)
+
+// LoginThrottle counts the failed login attempts for an account or for
+// a client address.
+type LoginThrottle struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	Subject      string    `json:"subject" db:"subject"`
+	Failures     int       `json:"failures" db:"failures"`
+	BlockedUntil time.Time `json:"blocked_until" db:"blocked_until"`
+}
+
+type LoginThrottles []LoginThrottle
+
+// UserThrottle returns the throttling subject of an account.
+// Accounts are identified by the username entered in the login form,
+// whether it exists or not, so that throttling does not disclose which
+// usernames are taken.
+func UserThrottle(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// IPThrottle returns the throttling subject of a client address.
+func IPThrottle(ip string) string {
+	return "ip:" + ip
+}
+
+// Username returns the username of an account subject.
+func (t LoginThrottle) Username() string {
+	return strings.TrimPrefix(t.Subject, "user:")
+}
+
+func (t LoginThrottle) isUser() bool {
+	return strings.HasPrefix(t.Subject, "user:")
+}
+
+// backoff returns the delay imposed after n failures beyond the free ones.
+func backoff(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	if n > 20 {
+		return loginMaxBackoff
+	}
+	d := time.Second << uint(n-1)
+	if d > loginMaxBackoff {
+		return loginMaxBackoff
+	}
+	return d
+}
+
+// fail records a failed attempt at time now.
+// It reports whether the account was locked out.
+// Attempts made while the account is locked out are not counted, so that
+// the lockout is neither extended nor reported again.
+func (t *LoginThrottle) fail(now time.Time) bool {
+	if t.lockedOut(now) {
+		return false
+	}
+	if now.Sub(t.UpdatedAt) > loginFailureWindow {
+		t.Failures = 0
+	}
+	t.Failures++
+	if !t.isUser() {
+		t.BlockedUntil = now.Add(backoff(t.Failures - loginIPFreeAttempts))
+		return false
+	}
+	if t.Failures >= LoginLockoutAttempts {
+		t.BlockedUntil = now.Add(LoginLockoutDuration)
+		return true
+	}
+	t.BlockedUntil = now.Add(backoff(t.Failures - loginUserFreeAttempts))
+	return false
+}
+
+// lockedOut reports whether the account is locked out at time now.
+func (t LoginThrottle) lockedOut(now time.Time) bool {
+	return t.isUser() && t.Failures >= LoginLockoutAttempts && now.Before(t.BlockedUntil)
+}
+
+// LoginBlocked returns how long login attempts are still refused for the
+// given subjects.
+func LoginBlocked(tx *pop.Connection, subjects ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, s := range subjects {
+		t := new(LoginThrottle)
+		err := tx.Where("subject = ?", s).First(t)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				continue
+			}
+			return 0, errors.WithStack(err)
+		}
+		if d := t.BlockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure records a failed login attempt for the given subjects.
+// It reports whether an account was locked out by this attempt.
+func RecordLoginFailure(tx *pop.Connection, subjects ...string) (bool, error) {
+	now := time.Now()
+	locked := false
+	for _, s := range subjects {
+		t := new(LoginThrottle)
+		err := tx.Where("subject = ?", s).First(t)
+		switch {
+		case err == nil:
+			locked = t.fail(now) || locked
+			err = tx.Update(t)
+		case errors.Cause(err) == sql.ErrNoRows:
+			t.Subject = s
+			locked = t.fail(now) || locked
+			err = tx.Create(t)
+		}
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+	}
+	return locked, nil
+}
+
+// ResetLoginFailures forgets the failed login attempts of a subject.
+func ResetLoginFailures(tx *pop.Connection, subject string) error {
+	err := tx.RawQuery("DELETE FROM login_throttles WHERE subject = ?", subject).Exec()
+	return errors.WithStack(err)
+}
+
+// LockedOutUsers returns the usernames of the accounts currently locked out.
+func LockedOutUsers(tx *pop.Connection) (map[string]bool, error) {
+	ts := new(LoginThrottles)
+	err := tx.Where("subject LIKE 'user:%' AND failures >= ? AND blocked_until > ?",
+		LoginLockoutAttempts, time.Now(),
+	).All(ts)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	users := make(map[string]bool, len(*ts))
+	for _, t := range *ts {
+		users[t.Username()] = true
+	}
+	return users, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+)
+
+func (ms *ModelSuite) Test_LoginThrottle() {
+	user := models.UserThrottle("Alice")
+	ip := models.IPThrottle("192.0.2.1")
+	ms.Equal("user:alice", user)
+
+	wait, err := models.LoginBlocked(ms.DB, user, ip)
+	ms.NoError(err)
+	ms.Zero(wait)
+
+	for i := 1; i < models.LoginLockoutAttempts; i++ {
+		locked, err := models.RecordLoginFailure(ms.DB, user, ip)
+		ms.NoError(err)
+		ms.False(locked, "attempt %d", i)
+	}
+	wait, err = models.LoginBlocked(ms.DB, user, ip)
+	ms.NoError(err)
+	ms.True(wait > 0, "failed attempts must back off")
+
+	locked, err := models.RecordLoginFailure(ms.DB, user, ip)
+	ms.NoError(err)
+	ms.True(locked)
+
+	wait, err = models.LoginBlocked(ms.DB, user)
+	ms.NoError(err)
+	ms.True(wait > models.LoginLockoutDuration/2)
+
+	// failures during the lockout neither extend nor repeat it.
+	locked, err = models.RecordLoginFailure(ms.DB, user)
+	ms.NoError(err)
+	ms.False(locked)
+	again, err := models.LoginBlocked(ms.DB, user)
+	ms.NoError(err)
+	ms.True(again <= wait)
+
+	lockedOut, err := models.LockedOutUsers(ms.DB)
+	ms.NoError(err)
+	ms.True(lockedOut["alice"])
+
+	ms.NoError(models.ResetLoginFailures(ms.DB, user))
+	wait, err = models.LoginBlocked(ms.DB, user)
+	ms.NoError(err)
+	ms.Zero(wait)
+
+	// the address backs off once its own free attempts are exhausted.
+	_, err = models.RecordLoginFailure(ms.DB, ip)
+	ms.NoError(err)
+	wait, err = models.LoginBlocked(ms.DB, ip)
+	ms.NoError(err)
+	ms.True(wait > 0)
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// mentionRE matches @username mentions.
+// Mentions must not follow a word character, so that email addresses are
+// not mistaken for mentions.
+var mentionRE = regexp.MustCompile(`(^|[^\w@/.])@([a-z0-9_](?:[a-z0-9_.-]*[a-z0-9_])?)`)
+
+// ReplaceMentions replaces the @username mentions of a line of text,
+// outside of inline code, with the result of f.
+func ReplaceMentions(line string, f func(username string) string) string {
+	parts := strings.Split(line, "`")
+	for i := 0; i < len(parts); i += 2 { // odd parts are inline code
+		parts[i] = mentionRE.ReplaceAllStringFunc(parts[i], func(m string) string {
+			sub := mentionRE.FindStringSubmatch(m)
+			return sub[1] + f(sub[2])
+		})
+	}
+	return strings.Join(parts, "`")
+}
+
+// Mentions returns the usernames mentioned in a post, ignoring code.
+func Mentions(content string) []string {
+	set := make(map[string]struct{})
+	code := false
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "```") {
+			code = !code
+			continue
+		}
+		if code {
+			continue
+		}
+		ReplaceMentions(line, func(name string) string {
+			set[name] = struct{}{}
+			return ""
+		})
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
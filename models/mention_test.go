@@ -0,0 +1,23 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+)
+
+func (ms *ModelSuite) Test_Mentions() {
+	content := "@bob and @alice.b, see this.\n" +
+		"mail me at carol@example.com, or ask @dave.\n" +
+		"`@eve` is code, and so is:\n" +
+		"```\n@frank\n```\n" +
+		"@bob again"
+	ms.Equal([]string{"alice.b", "bob", "dave"}, models.Mentions(content))
+	ms.Empty(models.Mentions("no mention"))
+
+	ms.Equal("hi [bob] `@bob`", models.ReplaceMentions("hi @bob `@bob`", func(name string) string {
+		return "[" + name + "]"
+	}))
+}
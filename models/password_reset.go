@@ -0,0 +1,106 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// PasswordResetTTL is how long a password reset token stays valid.
+const PasswordResetTTL = 1 * time.Hour
+
+// ErrInvalidToken is returned when a one-time token is unknown, expired
+// or was already used.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// PasswordReset is a single-use request to reset a user's password.
+// Only the hash of the token sent to the user is stored.
+type PasswordReset struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	Used      bool      `json:"used" db:"used"`
+}
+
+type PasswordResets []PasswordReset
+
+// NewPasswordReset creates a password reset for the given user and returns
+// the clear-text token to send to the user.
+func NewPasswordReset(tx *pop.Connection, usr *User) (string, error) {
+	tok, err := newToken()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	reset := &PasswordReset{
+		UserID:    usr.ID,
+		TokenHash: hashToken(tok),
+		ExpiresAt: time.Now().UTC().Add(PasswordResetTTL),
+	}
+	if err := tx.Create(reset); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return tok, nil
+}
+
+// FindPasswordReset retrieves the pending password reset matching the
+// given clear-text token.
+func FindPasswordReset(tx *pop.Connection, tok string) (*PasswordReset, error) {
+	reset := new(PasswordReset)
+	err := tx.Where("token_hash = ?", hashToken(tok)).First(reset)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, errors.WithStack(err)
+	}
+	if reset.Used || time.Now().UTC().After(reset.ExpiresAt.UTC()) {
+		return nil, ErrInvalidToken
+	}
+	return reset, nil
+}
+
+// Consume marks the password reset as used and discards all the other
+// pending password resets of the same user.
+func (p *PasswordReset) Consume(tx *pop.Connection) error {
+	p.Used = true
+	if err := tx.Update(p); err != nil {
+		return errors.WithStack(err)
+	}
+	err := tx.RawQuery(
+		"DELETE FROM password_resets WHERE user_id = ? AND id <> ?",
+		p.UserID, p.ID,
+	).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// newToken returns a random URL-safe token.
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 digest of a token.
+func hashToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
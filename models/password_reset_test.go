@@ -0,0 +1,51 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+)
+
+func (ms *ModelSuite) Test_PasswordReset() {
+	u := &models.User{
+		Username:        "usr1",
+		Email:           "user@example.com",
+		Password:        "password",
+		PasswordConfirm: "password",
+	}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	tok, err := models.NewPasswordReset(ms.DB, u)
+	ms.NoError(err)
+	ms.NotZero(tok)
+
+	n, err := ms.DB.Where("token_hash = ?", tok).Count("password_resets")
+	ms.NoError(err)
+	ms.Equal(0, n, "clear-text token must not be stored")
+
+	_, err = models.FindPasswordReset(ms.DB, "not-a-token")
+	ms.Equal(models.ErrInvalidToken, err)
+
+	reset, err := models.FindPasswordReset(ms.DB, tok)
+	ms.NoError(err)
+	ms.Equal(u.ID, reset.UserID)
+
+	ms.NoError(reset.Consume(ms.DB))
+	_, err = models.FindPasswordReset(ms.DB, tok)
+	ms.Equal(models.ErrInvalidToken, err, "token must be single-use")
+
+	tok, err = models.NewPasswordReset(ms.DB, u)
+	ms.NoError(err)
+	reset, err = models.FindPasswordReset(ms.DB, tok)
+	ms.NoError(err)
+	reset.ExpiresAt = time.Now().Add(-time.Minute)
+	ms.NoError(ms.DB.Update(reset))
+	_, err = models.FindPasswordReset(ms.DB, tok)
+	ms.Equal(models.ErrInvalidToken, err, "token must expire")
+}
@@ -0,0 +1,282 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/pop/slices"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// MaxPollOptions is the maximum number of options of a poll.
+const MaxPollOptions = 20
+
+// PollTimeLayout is the layout of the closing times of polls in forms.
+const PollTimeLayout = "2006-01-02T15:04"
+
+// Poll is a poll attached to a topic.
+type Poll struct {
+	ID        uuid.UUID     `json:"id" db:"id"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
+	TopicID   uuid.UUID     `json:"topic_id" db:"topic_id"`
+	Question  string        `json:"question" db:"question"`
+	Options   slices.String `json:"options" db:"options"`
+	Multiple  bool          `json:"multiple" db:"multiple"`   // whether voters may choose several options
+	Anonymous bool          `json:"anonymous" db:"anonymous"` // whether the voters are hidden
+	ClosesAt  nulls.Time    `json:"closes_at" db:"closes_at"` // no vote is accepted after it, if set
+}
+
+// PollVote is the choice of an option of a poll by a user.
+// Users choosing several options have a vote for each.
+type PollVote struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	PollID    uuid.UUID `json:"poll_id" db:"poll_id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Option    int       `json:"option" db:"option"`
+}
+
+type PollVotes []PollVote
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (p *Poll) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: p.Question, Name: "Question"},
+		&PollOptionsAreValid{Name: "Options", Field: p.Options},
+	), nil
+}
+
+// PollOptionsAreValid checks a poll has between 2 and MaxPollOptions
+// options.
+type PollOptionsAreValid struct {
+	Name  string
+	Field []string
+}
+
+// IsValid adds an error if the options are invalid.
+func (v *PollOptionsAreValid) IsValid(errors *validate.Errors) {
+	switch {
+	case len(v.Field) < 2:
+		errors.Add(validators.GenerateKey(v.Name), "A poll needs at least 2 options.")
+	case len(v.Field) > MaxPollOptions:
+		errors.Add(validators.GenerateKey(v.Name), fmt.Sprintf("A poll can not have more than %d options.", MaxPollOptions))
+	}
+}
+
+// ParsePollOptions parses the options of a poll, one per line.
+// Blank lines and duplicates are ignored.
+func ParsePollOptions(s string) []string {
+	set := make(map[string]bool)
+	var opts []string
+	for _, opt := range strings.Split(s, "\n") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" || set[opt] {
+			continue
+		}
+		set[opt] = true
+		opts = append(opts, opt)
+	}
+	return opts
+}
+
+// OptionList returns the options of the poll, one per line.
+func (p Poll) OptionList() string {
+	return strings.Join(p.Options, "\n")
+}
+
+// ClosesAtInput returns the closing time of the poll formatted with
+// PollTimeLayout, or an empty string if the poll has none.
+func (p Poll) ClosesAtInput() string {
+	if !p.ClosesAt.Valid {
+		return ""
+	}
+	return p.ClosesAt.Time.UTC().Format(PollTimeLayout)
+}
+
+// ClosingTime returns the closing time of the poll, for display.
+func (p Poll) ClosingTime() string {
+	if !p.ClosesAt.Valid {
+		return ""
+	}
+	return p.ClosesAt.Time.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// Closed reports whether the poll is closed at the given time.
+func (p Poll) Closed(now time.Time) bool {
+	return p.ClosesAt.Valid && !now.Before(p.ClosesAt.Time)
+}
+
+// IsClosed reports whether the poll is closed.
+func (p Poll) IsClosed() bool {
+	return p.Closed(time.Now())
+}
+
+// FindPoll returns the poll of a topic, or nil if the topic has none.
+func FindPoll(tx *pop.Connection, topic uuid.UUID) (*Poll, error) {
+	poll := new(Poll)
+	err := tx.Where("topic_id = ?", topic).First(poll)
+	switch {
+	case errors.Cause(err) == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.WithStack(err)
+	}
+	return poll, nil
+}
+
+// Votes returns the votes cast in the poll.
+func (p Poll) Votes(tx *pop.Connection) (PollVotes, error) {
+	votes := PollVotes{}
+	if err := tx.Where("poll_id = ?", p.ID).All(&votes); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return votes, nil
+}
+
+// CheckChoice checks the options chosen by a voter are valid choices.
+func (p Poll) CheckChoice(options []int) error {
+	if len(options) == 0 {
+		return errors.New("no option chosen")
+	}
+	if len(options) > 1 && !p.Multiple {
+		return errors.New("only one option may be chosen")
+	}
+	seen := make(map[int]bool)
+	for _, o := range options {
+		if o < 0 || o >= len(p.Options) {
+			return errors.Errorf("invalid option %d", o)
+		}
+		if seen[o] {
+			return errors.Errorf("duplicate option %d", o)
+		}
+		seen[o] = true
+	}
+	return nil
+}
+
+// Vote records the choice of the user uid, replacing any previous one.
+func (p Poll) Vote(tx *pop.Connection, uid uuid.UUID, options []int) error {
+	if p.IsClosed() {
+		return errors.New("the poll is closed")
+	}
+	if err := p.CheckChoice(options); err != nil {
+		return errors.WithStack(err)
+	}
+	err := tx.RawQuery("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?", p.ID, uid).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, o := range options {
+		if err := tx.Create(&PollVote{PollID: p.ID, UserID: uid, Option: o}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// CheckEdit checks the edited version edit of the poll does not
+// invalidate the votes already cast: options that received votes can be
+// neither changed nor moved, and a poll can not become single choice
+// once a voter chose several options, nor public once votes were cast
+// anonymously.
+// New options may be appended.
+func (p Poll) CheckEdit(edit *Poll, votes PollVotes) *validate.Errors {
+	verrs := validate.NewErrors()
+	perUser := make(map[uuid.UUID]int)
+	voted := make(map[int]bool)
+	for _, v := range votes {
+		perUser[v.UserID]++
+		voted[v.Option] = true
+	}
+	var opts []int
+	for o := range voted {
+		opts = append(opts, o)
+	}
+	sort.Ints(opts)
+	for _, o := range opts {
+		if o >= len(p.Options) {
+			continue
+		}
+		if o >= len(edit.Options) || edit.Options[o] != p.Options[o] {
+			verrs.Add("options", fmt.Sprintf("The option %q already received votes: it can not be changed, moved or removed.", p.Options[o]))
+		}
+	}
+	if p.Anonymous && !edit.Anonymous && len(votes) > 0 {
+		verrs.Add("anonymous", "Votes were cast anonymously: the poll must remain anonymous.")
+	}
+	if p.Multiple && !edit.Multiple {
+		for _, n := range perUser {
+			if n > 1 {
+				verrs.Add("multiple", "Voters already chose several options: the poll must remain multiple choice.")
+				break
+			}
+		}
+	}
+	return verrs
+}
+
+// PollOption is an option of a poll, with its votes.
+type PollOption struct {
+	Index   int
+	Text    string
+	Count   int
+	Percent int      // share of the voters who chose the option
+	Voters  []string // usernames of the voters, unless the poll is anonymous
+	Mine    bool     // whether the current user chose the option
+}
+
+// PollResults are the results of a poll.
+type PollResults struct {
+	Options []PollOption
+	Voters  int  // number of users who voted
+	Voted   bool // whether the current user voted
+}
+
+// Results tallies the votes of the poll.
+// The choices of the user uid are flagged.
+func (p Poll) Results(votes PollVotes, usernames map[uuid.UUID]string, uid uuid.UUID) PollResults {
+	res := PollResults{Options: make([]PollOption, len(p.Options))}
+	for i, opt := range p.Options {
+		res.Options[i] = PollOption{Index: i, Text: opt}
+	}
+	voters := make(map[uuid.UUID]bool)
+	for _, v := range votes {
+		if v.Option < 0 || v.Option >= len(p.Options) {
+			continue
+		}
+		voters[v.UserID] = true
+		opt := &res.Options[v.Option]
+		opt.Count++
+		opt.Mine = opt.Mine || v.UserID == uid
+		if !p.Anonymous {
+			opt.Voters = append(opt.Voters, usernames[v.UserID])
+		}
+	}
+	res.Voters = len(voters)
+	res.Voted = voters[uid]
+	for i := range res.Options {
+		opt := &res.Options[i]
+		sort.Strings(opt.Voters)
+		if res.Voters > 0 {
+			opt.Percent = opt.Count * 100 / res.Voters
+		}
+	}
+	return res
+}
+
+// Who returns the list of the voters who chose the option, for display.
+func (o PollOption) Who() string { return strings.Join(o.Voters, ", ") }
@@ -0,0 +1,98 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_ParsePollOptions() {
+	ms.Equal([]string{"yes", "no"}, models.ParsePollOptions(" yes\r\n\nno\nyes\n"))
+	ms.Nil(models.ParsePollOptions("\n "))
+}
+
+func (ms *ModelSuite) Test_Poll_CheckChoice() {
+	poll := models.Poll{Options: []string{"a", "b", "c"}}
+	ms.NoError(poll.CheckChoice([]int{1}))
+	ms.Error(poll.CheckChoice(nil))
+	ms.Error(poll.CheckChoice([]int{0, 1}))
+	ms.Error(poll.CheckChoice([]int{3}))
+
+	poll.Multiple = true
+	ms.NoError(poll.CheckChoice([]int{0, 2}))
+	ms.Error(poll.CheckChoice([]int{2, 2}))
+}
+
+func (ms *ModelSuite) Test_Poll_Closed() {
+	now := time.Now()
+	poll := models.Poll{}
+	ms.False(poll.Closed(now))
+	poll.ClosesAt = nulls.NewTime(now.Add(time.Hour))
+	ms.False(poll.Closed(now))
+	ms.True(poll.Closed(now.Add(time.Hour)))
+}
+
+func (ms *ModelSuite) Test_Poll_CheckEdit() {
+	alice := uuid.Must(uuid.NewV4())
+	poll := models.Poll{Options: []string{"a", "b", "c"}, Multiple: true, Anonymous: true}
+	votes := models.PollVotes{{UserID: alice, Option: 0}, {UserID: alice, Option: 2}}
+
+	edit := poll
+	edit.Options = []string{"a", "B", "c", "d"}
+	ms.False(poll.CheckEdit(&edit, votes).HasAny())
+
+	edit.Options = []string{"a", "c"}
+	ms.True(poll.CheckEdit(&edit, votes).HasAny())
+
+	edit.Options = poll.Options
+	edit.Multiple = false
+	ms.True(poll.CheckEdit(&edit, votes).HasAny())
+
+	edit.Multiple = true
+	edit.Anonymous = false
+	ms.True(poll.CheckEdit(&edit, votes).HasAny())
+	ms.False(poll.CheckEdit(&edit, nil).HasAny())
+}
+
+func (ms *ModelSuite) Test_Poll_Vote() {
+	poll := &models.Poll{
+		TopicID:  uuid.Must(uuid.NewV4()),
+		Question: "question",
+		Options:  []string{"a", "b", "c"},
+		Multiple: true,
+	}
+	verrs, err := ms.DB.ValidateAndCreate(poll)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	alice := uuid.Must(uuid.NewV4())
+	bob := uuid.Must(uuid.NewV4())
+
+	ms.NoError(poll.Vote(ms.DB, alice, []int{0, 1}))
+	ms.NoError(poll.Vote(ms.DB, bob, []int{1}))
+	ms.NoError(poll.Vote(ms.DB, alice, []int{1, 2}))
+	votes, err := poll.Votes(ms.DB)
+	ms.NoError(err)
+	ms.Len(votes, 3)
+
+	res := poll.Results(votes, map[uuid.UUID]string{alice: "alice", bob: "bob"}, alice)
+	ms.Equal(2, res.Voters)
+	ms.True(res.Voted)
+	ms.Equal(0, res.Options[0].Count)
+	ms.Equal(2, res.Options[1].Count)
+	ms.Equal(100, res.Options[1].Percent)
+	ms.Equal("alice, bob", res.Options[1].Who())
+	ms.True(res.Options[2].Mine)
+
+	found, err := models.FindPoll(ms.DB, poll.TopicID)
+	ms.NoError(err)
+	ms.Equal(poll.ID, found.ID)
+	found, err = models.FindPoll(ms.DB, uuid.Must(uuid.NewV4()))
+	ms.NoError(err)
+	ms.Nil(found)
+}
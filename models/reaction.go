@@ -0,0 +1,146 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// DefaultReactions are the reactions offered when the forum does not
+// configure its own.
+var DefaultReactions = []string{"👍", "❤️", "😄", "🎉", "😕"}
+
+// Reaction is the reaction of a user to a topic or to a reply.
+type Reaction struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	PostID    uuid.UUID `json:"post_id" db:"post_id"`
+	TopicID   uuid.UUID `json:"topic_id" db:"topic_id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Emoji     string    `json:"emoji" db:"emoji"`
+}
+
+type Reactions []Reaction
+
+// ReactionSet returns the reactions users may choose from.
+func (f Forum) ReactionSet() []string {
+	if len(f.Reactions) == 0 {
+		return DefaultReactions
+	}
+	return f.Reactions
+}
+
+// ReactionList returns the reactions users may choose from, space
+// separated.
+func (f Forum) ReactionList() string {
+	return strings.Join(f.ReactionSet(), " ")
+}
+
+// ParseReactions parses a space separated list of reactions.
+func ParseReactions(s string) []string {
+	var set []string
+	seen := make(map[string]bool)
+	for _, r := range strings.Fields(s) {
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		set = append(set, r)
+	}
+	return set
+}
+
+// ToggleReaction adds the reaction of a user to a post of a topic, or
+// removes it if the user already reacted so.
+// It reports whether the reaction was added.
+// The reaction count of the topic is updated accordingly.
+func ToggleReaction(tx *pop.Connection, topic, post, uid uuid.UUID, emoji string) (bool, error) {
+	r := new(Reaction)
+	err := tx.Where("post_id = ? AND user_id = ? AND emoji = ?", post, uid, emoji).First(r)
+	switch {
+	case err == nil:
+		if err := tx.Destroy(r); err != nil {
+			return false, errors.WithStack(err)
+		}
+		err = tx.RawQuery("UPDATE topics SET reactions = reactions - 1 WHERE id = ? AND reactions > 0", topic).Exec()
+		return false, errors.WithStack(err)
+	case errors.Cause(err) != sql.ErrNoRows:
+		return false, errors.WithStack(err)
+	}
+	r = &Reaction{PostID: post, TopicID: topic, UserID: uid, Emoji: emoji}
+	if err := tx.Create(r); err != nil {
+		return false, errors.WithStack(err)
+	}
+	err = tx.RawQuery("UPDATE topics SET reactions = reactions + 1 WHERE id = ?", topic).Exec()
+	return true, errors.WithStack(err)
+}
+
+// ReactionCount is the number of users who reacted to a post with a given
+// reaction.
+type ReactionCount struct {
+	Emoji string
+	Users []string // usernames of the users who reacted
+	Mine  bool     // whether the current user reacted
+}
+
+// Count returns the number of users who reacted.
+func (rc ReactionCount) Count() int { return len(rc.Users) }
+
+// Who returns the list of the users who reacted, for display.
+func (rc ReactionCount) Who() string { return strings.Join(rc.Users, ", ") }
+
+// Summarize aggregates the reactions to each post, in the order of set.
+// Reactions that are no longer in set come last.
+// The reactions of the user uid are flagged.
+func (p Reactions) Summarize(set []string, usernames map[uuid.UUID]string, uid uuid.UUID) map[string][]ReactionCount {
+	rank := make(map[string]int, len(set))
+	for i, emoji := range set {
+		rank[emoji] = i
+	}
+	counts := make(map[string]map[string]*ReactionCount)
+	for _, r := range p {
+		post := r.PostID.String()
+		if counts[post] == nil {
+			counts[post] = make(map[string]*ReactionCount)
+		}
+		rc := counts[post][r.Emoji]
+		if rc == nil {
+			rc = &ReactionCount{Emoji: r.Emoji}
+			counts[post][r.Emoji] = rc
+		}
+		rc.Users = append(rc.Users, usernames[r.UserID])
+		rc.Mine = rc.Mine || r.UserID == uid
+	}
+
+	sums := make(map[string][]ReactionCount, len(counts))
+	for post, cs := range counts {
+		sum := make([]ReactionCount, 0, len(cs))
+		for _, rc := range cs {
+			sort.Strings(rc.Users)
+			sum = append(sum, *rc)
+		}
+		sort.Slice(sum, func(i, j int) bool {
+			ri, oki := rank[sum[i].Emoji]
+			rj, okj := rank[sum[j].Emoji]
+			switch {
+			case oki && okj:
+				return ri < rj
+			case oki != okj:
+				return oki
+			}
+			return sum[i].Emoji < sum[j].Emoji
+		})
+		sums[post] = sum
+	}
+	return sums
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_ParseReactions() {
+	ms.Equal([]string{"+1", "heart"}, models.ParseReactions(" +1 heart  +1 "))
+	ms.Nil(models.ParseReactions(""))
+	ms.Equal(models.DefaultReactions, models.Forum{}.ReactionSet())
+}
+
+func (ms *ModelSuite) Test_ToggleReaction() {
+	topic := &models.Topic{
+		Title:      "title",
+		Content:    "content",
+		AuthorID:   uuid.Must(uuid.NewV4()),
+		CategoryID: uuid.Must(uuid.NewV4()),
+	}
+	ms.NoError(ms.DB.Create(topic))
+	usr := uuid.Must(uuid.NewV4())
+
+	added, err := models.ToggleReaction(ms.DB, topic.ID, topic.ID, usr, "+1")
+	ms.NoError(err)
+	ms.True(added)
+	ms.NoError(ms.DB.Find(topic, topic.ID))
+	ms.Equal(1, topic.Reactions)
+
+	added, err = models.ToggleReaction(ms.DB, topic.ID, topic.ID, usr, "+1")
+	ms.NoError(err)
+	ms.False(added)
+	ms.NoError(ms.DB.Find(topic, topic.ID))
+	ms.Equal(0, topic.Reactions)
+}
+
+func (ms *ModelSuite) Test_Reactions_Summarize() {
+	post := uuid.Must(uuid.NewV4())
+	alice := uuid.Must(uuid.NewV4())
+	bob := uuid.Must(uuid.NewV4())
+	reactions := models.Reactions{
+		{PostID: post, UserID: bob, Emoji: "old"},
+		{PostID: post, UserID: bob, Emoji: "b"},
+		{PostID: post, UserID: alice, Emoji: "b"},
+		{PostID: post, UserID: alice, Emoji: "a"},
+	}
+	names := map[uuid.UUID]string{alice: "alice", bob: "bob"}
+	sums := reactions.Summarize([]string{"a", "b"}, names, alice)
+
+	sum := sums[post.String()]
+	ms.Len(sum, 3)
+	ms.Equal("a", sum[0].Emoji)
+	ms.True(sum[0].Mine)
+	ms.Equal("b", sum[1].Emoji)
+	ms.Equal(2, sum[1].Count())
+	ms.Equal("alice, bob", sum[1].Who())
+	ms.Equal("old", sum[2].Emoji)
+	ms.False(sum[2].Mine)
+}
@@ -0,0 +1,258 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// TopicRead is the position a user read a topic up to: the creation time
+// of the last post the user read.
+// Posts keep their creation time when topics are merged or split, and the
+// positions are carried over to the topics they end up in.
+type TopicRead struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	TopicID   uuid.UUID `json:"topic_id" db:"topic_id"`
+	ReadAt    time.Time `json:"read_at" db:"read_at"`
+}
+
+type TopicReads []TopicRead
+
+// CategoryRead records that a user marked a category as read: the posts
+// of its topics created until ReadAt are read.
+// A single row per user and category is kept, however many topics the
+// category has.
+type CategoryRead struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+	CategoryID uuid.UUID `json:"category_id" db:"category_id"`
+	ReadAt     time.Time `json:"read_at" db:"read_at"`
+}
+
+type CategoryReads []CategoryRead
+
+// MarkTopicRead records that the user uid read the topic tid up to the
+// post created at t. Positions only move forward.
+// Concurrent requests of the same user upsert the same row, rather than
+// racing to create it.
+func MarkTopicRead(tx *pop.Connection, uid, tid uuid.UUID, t time.Time) error {
+	now := time.Now()
+	err := tx.RawQuery(`INSERT INTO topic_reads (id, created_at, updated_at, user_id, topic_id, read_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, topic_id) DO UPDATE
+		SET read_at = GREATEST(topic_reads.read_at, EXCLUDED.read_at), updated_at = EXCLUDED.updated_at`,
+		uuid.Must(uuid.NewV4()), now, now, uid, tid, t).Exec()
+	return errors.WithStack(err)
+}
+
+// splitReads gives the topic dst, split from the topic src, the positions
+// users read src up to: the posts of dst were posts of src.
+func splitReads(tx *pop.Connection, src, dst uuid.UUID) error {
+	reads := TopicReads{}
+	if err := tx.Where("topic_id = ?", src).All(&reads); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, r := range reads {
+		if err := tx.Create(&TopicRead{UserID: r.UserID, TopicID: dst, ReadAt: r.ReadAt}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// mergeReads adjusts the positions users read the topic dst up to, for
+// the posts of the topic src to be merged into it.
+// srcPosts and dstPosts are the creation times of the posts of src and
+// dst. A position is moved back before the first post of src the user did
+// not read; users who only read src keep their position if every post of
+// dst is newer.
+func mergeReads(tx *pop.Connection, src, dst uuid.UUID, srcPosts, dstPosts []time.Time) error {
+	reads := TopicReads{}
+	if err := tx.Where("topic_id = ?", src).All(&reads); err != nil {
+		return errors.WithStack(err)
+	}
+	srcAt := make(map[uuid.UUID]time.Time, len(reads))
+	for _, r := range reads {
+		srcAt[r.UserID] = r.ReadAt
+	}
+	reads = TopicReads{}
+	if err := tx.Where("topic_id = ?", dst).All(&reads); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, r := range reads {
+		unread := firstAfter(srcPosts, srcAt[r.UserID])
+		delete(srcAt, r.UserID)
+		if unread.IsZero() || unread.After(r.ReadAt) {
+			continue
+		}
+		r.ReadAt = unread.Add(-time.Microsecond)
+		if err := tx.Update(&r); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	first := firstAfter(dstPosts, time.Time{})
+	for uid, at := range srcAt {
+		if !first.After(at) {
+			continue
+		}
+		if err := tx.Create(&TopicRead{UserID: uid, TopicID: dst, ReadAt: at}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// firstAfter returns the earliest of times after t, or the zero time.
+func firstAfter(times []time.Time, t time.Time) time.Time {
+	var first time.Time
+	for _, v := range times {
+		if v.After(t) && (first.IsZero() || v.Before(first)) {
+			first = v
+		}
+	}
+	return first
+}
+
+// MarkCategoryRead records that the user uid read every post of the
+// category cid created until t.
+func MarkCategoryRead(tx *pop.Connection, uid, cid uuid.UUID, t time.Time) error {
+	now := time.Now()
+	err := tx.RawQuery(`INSERT INTO category_reads (id, created_at, updated_at, user_id, category_id, read_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, category_id) DO UPDATE
+		SET read_at = EXCLUDED.read_at, updated_at = EXCLUDED.updated_at`,
+		uuid.Must(uuid.NewV4()), now, now, uid, cid, t).Exec()
+	return errors.WithStack(err)
+}
+
+// ReadState tells which posts of a set of topics a user read.
+type ReadState struct {
+	since      time.Time // posts created earlier are read
+	topics     map[uuid.UUID]time.Time
+	categories map[uuid.UUID]time.Time
+	unread     map[uuid.UUID]int // see CountUnread
+}
+
+// LoadReadState loads what the user usr read of topics.
+// Posts created before the user signed up are considered read.
+func LoadReadState(tx *pop.Connection, usr *User, topics Topics) (*ReadState, error) {
+	rs := &ReadState{
+		since:      usr.CreatedAt,
+		topics:     make(map[uuid.UUID]time.Time, len(topics)),
+		categories: make(map[uuid.UUID]time.Time),
+	}
+	if len(topics) > 0 {
+		ids := make([]interface{}, 0, len(topics))
+		for _, t := range topics {
+			ids = append(ids, t.ID)
+		}
+		reads := TopicReads{}
+		if err := tx.Where("user_id = ?", usr.ID).Where("topic_id IN (?)", ids...).All(&reads); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, r := range reads {
+			rs.topics[r.TopicID] = r.ReadAt
+		}
+	}
+	cats := CategoryReads{}
+	if err := tx.Where("user_id = ?", usr.ID).All(&cats); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, r := range cats {
+		rs.categories[r.CategoryID] = r.ReadAt
+	}
+	return rs, nil
+}
+
+// mark returns the time until which the posts of a topic are read.
+func (rs *ReadState) mark(t Topic) time.Time {
+	mark := rs.since
+	if at := rs.categories[t.CategoryID]; at.After(mark) {
+		mark = at
+	}
+	if at := rs.topics[t.ID]; at.After(mark) {
+		mark = at
+	}
+	return mark
+}
+
+// IsNew reports whether none of the posts of a topic was read.
+func (rs *ReadState) IsNew(t Topic) bool {
+	return t.CreatedAt.After(rs.mark(t))
+}
+
+// unreadCount is the number of unread replies of a topic.
+type unreadCount struct {
+	TopicID uuid.UUID `db:"topic_id"`
+	Count   int       `db:"count"`
+}
+
+// CountUnread counts the unread replies of topics in a single query, so
+// that Unread does not need their replies to be loaded.
+func (rs *ReadState) CountUnread(tx *pop.Connection, topics Topics) error {
+	rs.unread = make(map[uuid.UUID]int, len(topics))
+	if len(topics) == 0 {
+		return nil
+	}
+	marks := make([]string, 0, len(topics))
+	args := make([]interface{}, 0, 2*len(topics))
+	for _, t := range topics {
+		marks = append(marks, "(?::uuid, ?::timestamp)")
+		args = append(args, t.ID, rs.mark(t))
+	}
+	q := "SELECT r.topic_id, COUNT(*) AS count FROM replies r" +
+		" JOIN (VALUES " + strings.Join(marks, ", ") + ") AS m (topic_id, read_at) ON r.topic_id = m.topic_id" +
+		" WHERE r.deleted = false AND r.event = '' AND r.created_at > m.read_at GROUP BY r.topic_id"
+	rows := []unreadCount{}
+	if err := tx.RawQuery(q, args...).All(&rows); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, r := range rows {
+		rs.unread[r.TopicID] = r.Count
+	}
+	return nil
+}
+
+// Unread returns the number of replies of a topic that were not read,
+// counted by CountUnread if it was called.
+func (rs *ReadState) Unread(t Topic) int {
+	if rs.unread != nil {
+		return rs.unread[t.ID]
+	}
+	mark := rs.mark(t)
+	n := 0
+	for _, r := range t.Replies.Posts() {
+		if r.CreatedAt.After(mark) {
+			n++
+		}
+	}
+	return n
+}
+
+// FirstUnread returns the ID of the first post of a topic that was not
+// read, or uuid.Nil if every post was read.
+// The replies of the topic must be sorted.
+func (rs *ReadState) FirstUnread(t Topic) uuid.UUID {
+	mark := rs.mark(t)
+	if t.CreatedAt.After(mark) {
+		return t.ID
+	}
+	for _, r := range t.Replies.Posts() {
+		if r.CreatedAt.After(mark) {
+			return r.ID
+		}
+	}
+	return uuid.Nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_ReadState() {
+	// the database keeps times to the microsecond.
+	t0 := time.Now().Add(-time.Hour).Truncate(time.Second)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	usr := &models.User{ID: uuid.Must(uuid.NewV4()), CreatedAt: t0}
+	cat := uuid.Must(uuid.NewV4())
+	topic := models.Topic{
+		ID:         uuid.Must(uuid.NewV4()),
+		CategoryID: cat,
+		CreatedAt:  at(10),
+		Replies: models.Replies{
+			{ID: uuid.Must(uuid.NewV4()), CreatedAt: at(20)},
+			{ID: uuid.Must(uuid.NewV4()), CreatedAt: at(30), Event: models.EventLocked},
+			{ID: uuid.Must(uuid.NewV4()), CreatedAt: at(40)},
+		},
+	}
+	// posts from before the user signed up are read.
+	old := models.Topic{ID: uuid.Must(uuid.NewV4()), CategoryID: cat, CreatedAt: at(-10)}
+	topics := models.Topics{topic, old}
+
+	reads, err := models.LoadReadState(ms.DB, usr, topics)
+	ms.NoError(err)
+	ms.True(reads.IsNew(topic))
+	ms.Equal(2, reads.Unread(topic))
+	ms.Equal(topic.ID, reads.FirstUnread(topic))
+	ms.False(reads.IsNew(old))
+	ms.Equal(uuid.Nil, reads.FirstUnread(old))
+
+	ms.NoError(models.MarkTopicRead(ms.DB, usr.ID, topic.ID, at(20)))
+	// positions only move forward.
+	ms.NoError(models.MarkTopicRead(ms.DB, usr.ID, topic.ID, at(10)))
+	reads, err = models.LoadReadState(ms.DB, usr, topics)
+	ms.NoError(err)
+	ms.False(reads.IsNew(topic))
+	ms.Equal(1, reads.Unread(topic))
+	ms.Equal(topic.Replies[2].ID, reads.FirstUnread(topic))
+	count, err := ms.DB.Where("user_id = ?", usr.ID).Count(&models.TopicRead{})
+	ms.NoError(err)
+	ms.Equal(1, count)
+
+	ms.NoError(models.MarkCategoryRead(ms.DB, usr.ID, cat, at(50)))
+	reads, err = models.LoadReadState(ms.DB, usr, topics)
+	ms.NoError(err)
+	ms.Equal(0, reads.Unread(topic))
+	ms.Equal(uuid.Nil, reads.FirstUnread(topic))
+	count, err = ms.DB.Where("user_id = ?", usr.ID).Count(&models.CategoryRead{})
+	ms.NoError(err)
+	ms.Equal(1, count)
+}
+
+func (ms *ModelSuite) Test_ReadState_CountUnread() {
+	usr := &models.User{ID: uuid.Must(uuid.NewV4()), CreatedAt: time.Now().Add(-time.Hour)}
+	topic := &models.Topic{Title: "topic", Content: "content", CategoryID: uuid.Must(uuid.NewV4()), AuthorID: usr.ID}
+	ms.NoError(ms.DB.Create(topic))
+	empty := &models.Topic{Title: "empty", Content: "content", CategoryID: topic.CategoryID, AuthorID: usr.ID}
+	ms.NoError(ms.DB.Create(empty))
+	first := &models.Reply{TopicID: topic.ID, AuthorID: usr.ID, Content: "first"}
+	ms.NoError(ms.DB.Create(first))
+	ms.NoError(ms.DB.Create(&models.Reply{TopicID: topic.ID, AuthorID: usr.ID, Content: "second"}))
+	ms.NoError(ms.DB.Create(&models.Reply{TopicID: topic.ID, AuthorID: usr.ID, Content: "deleted", Deleted: true}))
+	ms.NoError(models.AddEvent(ms.DB, topic.ID, usr.ID, models.EventLocked))
+	topics := models.Topics{*topic, *empty}
+
+	// events and deleted replies are not counted.
+	reads, err := models.LoadReadState(ms.DB, usr, topics)
+	ms.NoError(err)
+	ms.NoError(reads.CountUnread(ms.DB, topics))
+	ms.Equal(2, reads.Unread(*topic))
+	ms.Equal(0, reads.Unread(*empty))
+
+	ms.NoError(models.MarkTopicRead(ms.DB, usr.ID, topic.ID, first.CreatedAt))
+	reads, err = models.LoadReadState(ms.DB, usr, topics)
+	ms.NoError(err)
+	ms.NoError(reads.CountUnread(ms.DB, topics))
+	ms.Equal(1, reads.Unread(*topic))
+}
+
+func (ms *ModelSuite) Test_Topic_LastPost() {
+	t0 := time.Now()
+	topic := models.Topic{
+		CreatedAt: t0,
+		Replies: models.Replies{
+			{CreatedAt: t0.Add(2 * time.Minute)},
+			{CreatedAt: t0.Add(time.Minute)},
+		},
+	}
+	ms.Equal(t0.Add(2*time.Minute), topic.LastPost())
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// NumRecoveryCodes is the number of recovery codes generated when
+// two-factor authentication is enabled.
+const NumRecoveryCodes = 10
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// user lost access to the authenticator application.
+// Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	CodeHash  string    `json:"-" db:"code_hash"`
+}
+
+type RecoveryCodes []RecoveryCode
+
+// NewRecoveryCodes replaces the recovery codes of the user and returns
+// the new clear-text codes.
+func NewRecoveryCodes(tx *pop.Connection, usr *User) ([]string, error) {
+	err := tx.RawQuery("DELETE FROM recovery_codes WHERE user_id = ?", usr.ID).Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	codes := make([]string, NumRecoveryCodes)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		codes[i] = code[:4] + "-" + code[4:]
+		err := tx.Create(&RecoveryCode{
+			UserID:   usr.ID,
+			CodeHash: hashToken(normalizeRecoveryCode(codes[i])),
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode consumes the given recovery code of the user.
+// It reports whether the code was valid.
+func UseRecoveryCode(tx *pop.Connection, usr *User, code string) (bool, error) {
+	rc := new(RecoveryCode)
+	err := tx.Where(
+		"user_id = ? AND code_hash = ?",
+		usr.ID, hashToken(normalizeRecoveryCode(code)),
+	).First(rc)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	if err := tx.Destroy(rc); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return true, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.Replace(code, "-", "", -1)
+}
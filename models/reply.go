@@ -5,22 +5,28 @@
 package models
 
 import (
+	"sort"
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
 )
 
 type Reply struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
-	AuthorID  uuid.UUID `json:"author_id" db:"author_id"`
-	TopicID   uuid.UUID `json:"topic_id" db:"topic_id"`
-	Content   string    `json:"content" db:"content"`
-	Deleted   bool      `json:"deleted" db:"deleted"`
+	ID            uuid.UUID  `json:"id" db:"id"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+	AuthorID      uuid.UUID  `json:"author_id" db:"author_id"`
+	TopicID       uuid.UUID  `json:"topic_id" db:"topic_id"`
+	Content       string     `json:"content" db:"content"`
+	Deleted       bool       `json:"deleted" db:"deleted"`
+	EditedAt      nulls.Time `json:"edited_at" db:"edited_at"`
+	ParentReplyID nulls.UUID `json:"parent_reply_id" db:"parent_reply_id"` // the reply this reply answers, if any
+	Event         string     `json:"event,omitempty" db:"event"`           // the state change recorded by an event post, if any
+	EventTarget   nulls.UUID `json:"event_target" db:"event_target"`       // the category or topic the event refers to, if any
 
 	Author *User  `json:"-" db:"-"`
 	Topic  *Topic `json:"-" db:"-"`
@@ -38,3 +44,68 @@ func (p *Reply) Validate(tx *pop.Connection) (*validate.Errors, error) {
 func (p Replies) Len() int           { return len(p) }
 func (p Replies) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 func (p Replies) Less(i, j int) bool { return p[i].CreatedAt.Before(p[j].CreatedAt) }
+
+// maxReplyIndent is the deepest indentation level of threaded replies.
+const maxReplyIndent = 6
+
+// ReplyNode is a reply placed in the reply tree of a topic.
+type ReplyNode struct {
+	Reply
+	Depth int
+}
+
+// Indent returns the indentation level of the reply.
+func (n ReplyNode) Indent() int {
+	if n.Depth > maxReplyIndent {
+		return maxReplyIndent
+	}
+	return n.Depth
+}
+
+// Flat returns the replies in chronological order.
+func (p Replies) Flat() []ReplyNode {
+	replies := make(Replies, len(p))
+	copy(replies, p)
+	sort.Sort(replies)
+	nodes := make([]ReplyNode, len(replies))
+	for i, r := range replies {
+		nodes[i] = ReplyNode{Reply: r}
+	}
+	return nodes
+}
+
+// Thread returns the replies in threaded order: each reply is followed by
+// its answers, in chronological order.
+// Replies whose parent is not in the list are treated as roots.
+func (p Replies) Thread() []ReplyNode {
+	ids := make(map[uuid.UUID]bool, len(p))
+	for _, r := range p {
+		ids[r.ID] = true
+	}
+	children := make(map[uuid.UUID]Replies)
+	var roots Replies
+	for _, r := range p {
+		if r.ParentReplyID.Valid && r.ParentReplyID.UUID != r.ID && ids[r.ParentReplyID.UUID] {
+			children[r.ParentReplyID.UUID] = append(children[r.ParentReplyID.UUID], r)
+			continue
+		}
+		roots = append(roots, r)
+	}
+
+	nodes := make([]ReplyNode, 0, len(p))
+	seen := make(map[uuid.UUID]bool, len(p))
+	var walk func(rs Replies, depth int)
+	walk = func(rs Replies, depth int) {
+		sort.Sort(rs)
+		for _, r := range rs {
+			if seen[r.ID] {
+				continue
+			}
+			seen[r.ID] = true
+			nodes = append(nodes, ReplyNode{Reply: r, Depth: depth})
+			walk(children[r.ID], depth+1)
+		}
+	}
+	walk(roots, 0)
+	return nodes
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_Replies_Thread() {
+	now := time.Now()
+	reply := func(name string, min int, parent *models.Reply) models.Reply {
+		r := models.Reply{
+			ID:        uuid.Must(uuid.NewV4()),
+			CreatedAt: now.Add(time.Duration(min) * time.Minute),
+			Content:   name,
+		}
+		if parent != nil {
+			r.ParentReplyID = nulls.NewUUID(parent.ID)
+		}
+		return r
+	}
+	a := reply("a", 0, nil)
+	b := reply("b", 1, nil)
+	a1 := reply("a1", 2, &a)
+	a11 := reply("a11", 3, &a1)
+	a2 := reply("a2", 4, &a)
+	orphan := reply("orphan", 5, &models.Reply{ID: uuid.Must(uuid.NewV4())})
+	replies := models.Replies{orphan, a2, a11, b, a1, a}
+
+	var names []string
+	var depths []int
+	for _, n := range replies.Thread() {
+		names = append(names, n.Content)
+		depths = append(depths, n.Depth)
+	}
+	ms.Equal([]string{"a", "a1", "a11", "a2", "b", "orphan"}, names)
+	ms.Equal([]int{0, 1, 2, 1, 0, 0}, depths)
+
+	names = nil
+	for _, n := range replies.Flat() {
+		names = append(names, n.Content)
+		ms.Equal(0, n.Indent())
+	}
+	ms.Equal([]string{"a", "b", "a1", "a11", "a2", "orphan"}, names)
+	ms.Equal(models.Replies{orphan, a2, a11, b, a1, a}, replies)
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Revision is a version of a topic or of a reply.
+// Title is empty for replies.
+type Revision struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	PostID    uuid.UUID `json:"post_id" db:"post_id"`
+	EditorID  uuid.UUID `json:"editor_id" db:"editor_id"`
+	Title     string    `json:"title" db:"title"`
+	Content   string    `json:"content" db:"content"`
+	Reason    string    `json:"reason" db:"reason"`
+
+	Editor *User `json:"-" db:"-"`
+}
+
+type Revisions []Revision
+
+func (p Revisions) Len() int           { return len(p) }
+func (p Revisions) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p Revisions) Less(i, j int) bool { return p[i].CreatedAt.Before(p[j].CreatedAt) }
+
+// Revision returns a snapshot of the current version of the topic.
+func (t Topic) Revision(editor uuid.UUID, reason string) *Revision {
+	return &Revision{
+		PostID:   t.ID,
+		EditorID: editor,
+		Title:    t.Title,
+		Content:  t.Content,
+		Reason:   reason,
+	}
+}
+
+// Revision returns a snapshot of the current version of the reply.
+func (r Reply) Revision(editor uuid.UUID, reason string) *Revision {
+	return &Revision{
+		PostID:   r.ID,
+		EditorID: editor,
+		Content:  r.Content,
+		Reason:   reason,
+	}
+}
+
+// AddRevision records a new version of a post.
+// The first time a post is edited, its original version orig is recorded
+// as well, so that the history of the post is complete.
+func AddRevision(tx *pop.Connection, orig, rev *Revision) error {
+	n, err := tx.Where("post_id = ?", rev.PostID).Count(&Revision{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		if err := tx.Create(orig); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(tx.Create(rev))
+}
+
+// FindRevisions returns the versions of a post, oldest first.
+func FindRevisions(tx *pop.Connection, pid uuid.UUID) (Revisions, error) {
+	revs := Revisions{}
+	if err := tx.Where("post_id = ?", pid).Order("created_at asc").All(&revs); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return revs, nil
+}
+
+// DiffLine is a line of a diff between two texts.
+// Op is "+" for an added line, "-" for a removed line, and " " for a line
+// common to both texts.
+type DiffLine struct {
+	Op   string
+	Text string
+}
+
+// Changed reports whether the line was added or removed.
+func (d DiffLine) Changed() bool { return d.Op != " " }
+
+// DiffLines returns the line diff from a to b.
+func DiffLines(a, b string) []DiffLine {
+	as := strings.Split(strings.Replace(a, "\r\n", "\n", -1), "\n")
+	bs := strings.Split(strings.Replace(b, "\r\n", "\n", -1), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence
+	// of as[i:] and bs[j:].
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			switch {
+			case as[i] == bs[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			diff = append(diff, DiffLine{Op: " ", Text: as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "-", Text: as[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "+", Text: bs[j]})
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		diff = append(diff, DiffLine{Op: "-", Text: as[i]})
+	}
+	for ; j < len(bs); j++ {
+		diff = append(diff, DiffLine{Op: "+", Text: bs[j]})
+	}
+	return diff
+}
+
+// RevisionDiff is a revision along with the changes it introduced.
+type RevisionDiff struct {
+	Revision
+	Number       int
+	TitleChanged bool
+	PrevTitle    string
+	Diff         []DiffLine
+}
+
+// Diffs returns the revisions, newest first, each one with its changes
+// from the previous revision.
+func (p Revisions) Diffs() []RevisionDiff {
+	diffs := make([]RevisionDiff, len(p))
+	for i, rev := range p {
+		d := RevisionDiff{Revision: rev, Number: i + 1}
+		if i == 0 {
+			d.Diff = DiffLines(rev.Content, rev.Content)
+		} else {
+			prev := p[i-1]
+			d.TitleChanged = prev.Title != rev.Title
+			d.PrevTitle = prev.Title
+			d.Diff = DiffLines(prev.Content, rev.Content)
+		}
+		diffs[len(p)-1-i] = d
+	}
+	return diffs
+}
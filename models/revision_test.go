@@ -0,0 +1,50 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_DiffLines() {
+	diff := models.DiffLines("a\nb\nc", "a\nc\nd")
+	ms.Equal([]models.DiffLine{
+		{Op: " ", Text: "a"},
+		{Op: "-", Text: "b"},
+		{Op: " ", Text: "c"},
+		{Op: "+", Text: "d"},
+	}, diff)
+	ms.False(diff[0].Changed())
+	ms.True(diff[1].Changed())
+}
+
+func (ms *ModelSuite) Test_Revisions() {
+	author := uuid.Must(uuid.NewV4())
+	editor := uuid.Must(uuid.NewV4())
+	topic := models.Topic{ID: uuid.Must(uuid.NewV4()), Title: "title", Content: "v1"}
+
+	orig := topic.Revision(author, "")
+	topic.Content = "v2"
+	ms.NoError(models.AddRevision(ms.DB, orig, topic.Revision(editor, "typo")))
+
+	orig = topic.Revision(author, "")
+	topic.Title = "new title"
+	ms.NoError(models.AddRevision(ms.DB, orig, topic.Revision(editor, "")))
+
+	revs, err := models.FindRevisions(ms.DB, topic.ID)
+	ms.NoError(err)
+	ms.Len(revs, 3)
+	ms.Equal("v1", revs[0].Content)
+	ms.Equal(author, revs[0].EditorID)
+	ms.Equal("typo", revs[1].Reason)
+
+	diffs := revs.Diffs()
+	ms.Equal(3, diffs[0].Number)
+	ms.True(diffs[0].TitleChanged)
+	ms.Equal("title", diffs[0].PrevTitle)
+	ms.False(diffs[1].TitleChanged)
+	ms.Equal([]models.DiffLine{{Op: "-", Text: "v1"}, {Op: "+", Text: "v2"}}, diffs[1].Diff)
+}
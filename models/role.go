@@ -0,0 +1,132 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/slices"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// Permissions that can be granted to users through their roles.
+const (
+	PermCreateCategory = "create-category" // create and administer categories
+	PermModerate       = "moderate"        // delete the posts of other users
+	PermEditAnyPost    = "edit-any-post"   // edit the posts of other users
+	PermManageUsers    = "manage-users"    // manage users, roles and forum settings
+)
+
+// Permissions lists all the known permissions.
+var Permissions = []string{
+	PermCreateCategory,
+	PermModerate,
+	PermEditAnyPost,
+	PermManageUsers,
+}
+
+// AdminRole is the name of the role holding all permissions.
+const AdminRole = "admin"
+
+// Role is a named set of permissions.
+type Role struct {
+	ID          uuid.UUID     `json:"id" db:"id"`
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" db:"updated_at"`
+	Name        string        `json:"name" db:"name" form:"Name"`
+	Permissions slices.String `json:"permissions" db:"permissions" form:"Permissions"`
+}
+
+// String is not required by pop and may be deleted
+func (r Role) String() string {
+	jr, _ := json.Marshal(r)
+	return string(jr)
+}
+
+// Has reports whether the role grants the given permission.
+func (r Role) Has(perm string) bool {
+	for _, p := range r.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles is not required by pop and may be deleted
+type Roles []Role
+
+// String is not required by pop and may be deleted
+func (r Roles) String() string {
+	jr, _ := json.Marshal(r)
+	return string(jr)
+}
+
+func (p Roles) Len() int           { return len(p) }
+func (p Roles) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p Roles) Less(i, j int) bool { return p[i].Name < p[j].Name }
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (r *Role) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	verrs := validate.Validate(
+		&validators.StringIsPresent{Field: r.Name, Name: "Name"},
+		&RoleNameNotTaken{Name: "Name", Field: r.Name, ID: r.ID, tx: tx},
+	)
+	for _, p := range r.Permissions {
+		verrs.Append(validate.Validate(
+			&validators.StringInclusion{Field: p, Name: "Permissions", List: Permissions},
+		))
+	}
+	return verrs, nil
+}
+
+// FindRole retrieves a role by name.
+func FindRole(tx *pop.Connection, name string) (*Role, error) {
+	r := new(Role)
+	if err := tx.Where("name = ?", name).First(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// FindOrCreateAdminRole retrieves the admin role, creating it with all
+// permissions if needed.
+func FindOrCreateAdminRole(tx *pop.Connection) (*Role, error) {
+	r, err := FindRole(tx, AdminRole)
+	if err == nil {
+		return r, nil
+	}
+	if errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+	r = &Role{Name: AdminRole, Permissions: slices.String(Permissions)}
+	if err := tx.Create(r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r, nil
+}
+
+type RoleNameNotTaken struct {
+	Name  string
+	Field string
+	ID    uuid.UUID
+	tx    *pop.Connection
+}
+
+// IsValid performs the validation check for unique role names
+func (v *RoleNameNotTaken) IsValid(errors *validate.Errors) {
+	query := v.tx.Where("name = ? AND id != ?", v.Field, v.ID)
+	n, err := query.Count(&Role{})
+	if err == nil && n > 0 {
+		errors.Add(validators.GenerateKey(v.Name), fmt.Sprintf("The role %s already exists.", v.Field))
+	}
+}
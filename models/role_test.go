@@ -0,0 +1,59 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/slices"
+)
+
+func (ms *ModelSuite) Test_Role() {
+	admin, err := models.FindOrCreateAdminRole(ms.DB)
+	ms.NoError(err)
+	for _, p := range models.Permissions {
+		ms.True(admin.Has(p))
+	}
+	again, err := models.FindOrCreateAdminRole(ms.DB)
+	ms.NoError(err)
+	ms.Equal(admin.ID, again.ID)
+
+	mod := &models.Role{Name: "moderator", Permissions: slices.String{models.PermModerate}}
+	verrs, err := ms.DB.ValidateAndCreate(mod)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	dup := &models.Role{Name: "moderator"}
+	verrs, err = ms.DB.ValidateAndCreate(dup)
+	ms.NoError(err)
+	ms.True(verrs.HasAny(), "role names are unique")
+
+	bad := &models.Role{Name: "bad", Permissions: slices.String{"fly"}}
+	verrs, err = ms.DB.ValidateAndCreate(bad)
+	ms.NoError(err)
+	ms.True(verrs.HasAny(), "unknown permission")
+
+	u := &models.User{
+		Username:        "usr1",
+		Email:           "user@example.com",
+		Password:        "password",
+		PasswordConfirm: "password",
+	}
+	verrs, err = u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	ms.NoError(u.LoadPermissions(ms.DB))
+	ms.False(u.Privileged())
+	ms.False(u.CanDelete(mod.ID, nil))
+	ms.True(u.CanDelete(u.ID, nil))
+
+	u.Roles = slices.UUID{mod.ID}
+	ms.NoError(u.LoadPermissions(ms.DB))
+	ms.True(u.Privileged())
+	ms.True(u.Can(models.PermModerate))
+	ms.False(u.Can(models.PermManageUsers))
+	ms.True(u.CanDelete(mod.ID, nil))
+	ms.False(u.CanEdit(mod.ID, nil))
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gobuffalo/validate"
+)
+
+// MaxTopicTags is the maximum number of tags of a topic.
+const MaxTopicTags = 5
+
+// NormalizeTag returns the canonical form of a tag: lower case, with
+// runs of spaces replaced by dashes, and only letters, digits, dashes and
+// underscores kept.
+func NormalizeTag(tag string) string {
+	tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, tag)
+}
+
+// ParseTags parses a comma separated list of tags.
+// Tags are normalized, deduplicated and sorted.
+func ParseTags(s string) []string {
+	set := make(map[string]bool)
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = NormalizeTag(tag)
+		if tag == "" || set[tag] {
+			continue
+		}
+		set[tag] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// TagList returns the tags of the topic, comma separated.
+func (t Topic) TagList() string {
+	return strings.Join(t.Tags, ", ")
+}
+
+// HasTag reports whether the topic is tagged with tag.
+func (t Topic) HasTag(tag string) bool {
+	for _, v := range t.Tags {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Tagged returns the topics tagged with tag.
+func (p Topics) Tagged(tag string) Topics {
+	var topics Topics
+	for _, t := range p {
+		if t.HasTag(tag) {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// Tags returns the tags used by the topics, sorted.
+func (p Topics) Tags() []string {
+	set := make(map[string]bool)
+	var tags []string
+	for _, t := range p {
+		for _, tag := range t.Tags {
+			if !set[tag] {
+				set[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// TagList returns the tags users may choose from, comma separated.
+// It is empty when tags are free.
+func (f Forum) TagList() string {
+	return strings.Join(f.Tags, ", ")
+}
+
+// CheckTags validates the tags of a topic: there can not be more than
+// MaxTopicTags of them and, when the forum curates its tags, they must
+// be among them.
+func (f Forum) CheckTags(tags []string) *validate.Errors {
+	verrs := validate.NewErrors()
+	if len(tags) > MaxTopicTags {
+		verrs.Add("tags", fmt.Sprintf("A topic can not have more than %d tags.", MaxTopicTags))
+	}
+	if len(f.Tags) == 0 {
+		return verrs
+	}
+	allowed := make(map[string]bool, len(f.Tags))
+	for _, tag := range f.Tags {
+		allowed[tag] = true
+	}
+	for _, tag := range tags {
+		if !allowed[tag] {
+			verrs.Add("tags", fmt.Sprintf("%q is not an available tag.", tag))
+		}
+	}
+	return verrs
+}
+
+// FollowsTags reports whether the user subscribed to any of the tags.
+func (u User) FollowsTags(tags []string) bool {
+	for _, tag := range tags {
+		if u.FollowsTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// FollowsTag reports whether the user subscribed to tag.
+func (u User) FollowsTag(tag string) bool {
+	for _, v := range u.TagSubscriptions {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTagSubscription subscribes the user to tag.
+func (u *User) AddTagSubscription(tag string) {
+	if !u.FollowsTag(tag) {
+		u.TagSubscriptions = append(u.TagSubscriptions, tag)
+		sort.Strings(u.TagSubscriptions)
+	}
+}
+
+// RemoveTagSubscription unsubscribes the user from tag.
+func (u *User) RemoveTagSubscription(tag string) {
+	tags := u.TagSubscriptions[:0]
+	for _, v := range u.TagSubscriptions {
+		if v != tag {
+			tags = append(tags, v)
+		}
+	}
+	u.TagSubscriptions = tags
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+)
+
+func (ms *ModelSuite) Test_ParseTags() {
+	ms.Equal("go-modules", models.NormalizeTag("  Go   Modules! "))
+	ms.Equal([]string{"bug", "go-modules"}, models.ParseTags("Go modules, bug,, BUG"))
+	ms.Nil(models.ParseTags(" , "))
+}
+
+func (ms *ModelSuite) Test_Forum_CheckTags() {
+	forum := models.Forum{}
+	ms.False(forum.CheckTags([]string{"anything"}).HasAny())
+	ms.True(forum.CheckTags([]string{"a", "b", "c", "d", "e", "f"}).HasAny())
+
+	forum.Tags = []string{"bug", "question"}
+	ms.False(forum.CheckTags([]string{"bug"}).HasAny())
+	ms.True(forum.CheckTags([]string{"bug", "feature"}).HasAny())
+}
+
+func (ms *ModelSuite) Test_Topics_Tags() {
+	topics := models.Topics{
+		{Title: "a", Tags: []string{"go", "bug"}},
+		{Title: "b"},
+		{Title: "c", Tags: []string{"go"}},
+	}
+	ms.Equal([]string{"bug", "go"}, topics.Tags())
+	ms.Len(topics.Tagged("go"), 2)
+	ms.Len(topics.Tagged("bug"), 1)
+}
+
+func (ms *ModelSuite) Test_User_TagSubscriptions() {
+	usr := &models.User{}
+	usr.AddTagSubscription("go")
+	usr.AddTagSubscription("bug")
+	usr.AddTagSubscription("go")
+	ms.Equal([]string{"bug", "go"}, []string(usr.TagSubscriptions))
+	ms.True(usr.FollowsTags([]string{"rust", "go"}))
+	ms.False(usr.FollowsTags([]string{"rust"}))
+
+	usr.RemoveTagSubscription("go")
+	ms.False(usr.FollowsTag("go"))
+	ms.True(usr.FollowsTag("bug"))
+}
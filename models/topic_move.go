@@ -0,0 +1,245 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+)
+
+// Topic moves, recorded as event posts. The event posts refer to the
+// other category or topic involved.
+const (
+	EventMoved     = "moved"      // the topic was moved from another category
+	EventMerged    = "merged"     // another topic was merged into the topic
+	EventSplit     = "split"      // replies of the topic were split into a new topic
+	EventSplitFrom = "split-from" // the topic was split from another topic
+)
+
+// MoveTopic moves a topic to the category dst, on behalf of the user uid.
+func MoveTopic(tx *pop.Connection, topic *Topic, dst, uid uuid.UUID) error {
+	src := topic.CategoryID
+	if src == dst {
+		return nil
+	}
+	topic.CategoryID = dst
+	if err := tx.Update(topic); err != nil {
+		return errors.WithStack(err)
+	}
+	return addEvent(tx, topic.ID, uid, EventMoved, nulls.NewUUID(src))
+}
+
+// MergeTopic merges the topic src into the topic dst, on behalf of the
+// user uid.
+// The opening post of src becomes a reply of dst, keeping its ID, and the
+// replies of src move to dst. Posts keep their dates, so that the merged
+// thread reads in chronological order.
+// src is then deleted, and redirects to dst.
+func MergeTopic(tx *pop.Connection, src, dst *Topic, uid uuid.UUID) error {
+	if src.ID == dst.ID {
+		return errors.New("can not merge a topic into itself")
+	}
+	if src.Deleted || src.MergedInto.Valid {
+		return errors.Errorf("can not merge the deleted topic %s", src.ID)
+	}
+	srcPosts, err := postTimes(tx, src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dstPosts, err := postTimes(tx, dst)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := mergeReads(tx, src.ID, dst.ID, srcPosts, dstPosts); err != nil {
+		return errors.WithStack(err)
+	}
+	op := &Reply{
+		ID:       src.ID,
+		AuthorID: src.AuthorID,
+		TopicID:  dst.ID,
+		Content:  src.Content,
+		EditedAt: src.EditedAt,
+	}
+	if err := tx.Create(op); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := setDates(tx, "replies", op.ID, src.CreatedAt, src.UpdatedAt); err != nil {
+		return errors.WithStack(err)
+	}
+	// answers to src become answers to its opening post.
+	err = tx.RawQuery("UPDATE replies SET parent_reply_id = ? WHERE topic_id = ? AND parent_reply_id IS NULL AND event = ''", src.ID, src.ID).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, q := range []string{
+		"UPDATE replies SET topic_id = ? WHERE topic_id = ?",
+		"UPDATE reactions SET topic_id = ? WHERE topic_id = ?",
+		"UPDATE attachments SET topic_id = ? WHERE topic_id = ?",
+		// topics merged into src earlier now redirect to dst.
+		"UPDATE topics SET merged_into = ? WHERE merged_into = ?",
+	} {
+		if err := tx.RawQuery(q, dst.ID, src.ID).Exec(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	// the poll of src is kept if dst has none.
+	err = tx.RawQuery("UPDATE polls SET topic_id = ? WHERE topic_id = ? AND NOT EXISTS (SELECT 1 FROM polls WHERE topic_id = ?)", dst.ID, src.ID, dst.ID).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, sub := range src.Subscribers {
+		dst.AddSubscriber(sub)
+	}
+	if err := tx.Update(dst); err != nil {
+		return errors.WithStack(err)
+	}
+	src.Deleted = true
+	src.MergedInto = nulls.NewUUID(dst.ID)
+	src.SolutionID = nulls.UUID{}
+	if err := tx.Update(src); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := countReactions(tx, src.ID, dst.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	return addEvent(tx, dst.ID, uid, EventMerged, nulls.NewUUID(src.ID))
+}
+
+// SplitTopic moves the replies rids of the topic src to a new topic of the
+// category cat, titled title, on behalf of the user uid.
+// The earliest of the replies becomes the opening post of the new topic,
+// keeping its ID; their authors are subscribed to the new topic.
+// Answers to replies left in the other topic become answers to the topic.
+func SplitTopic(tx *pop.Connection, src *Topic, rids []uuid.UUID, title string, cat, uid uuid.UUID) (*Topic, *validate.Errors, error) {
+	verrs := validate.NewErrors()
+	all := Replies{}
+	if err := tx.Where("topic_id = ?", src.ID).All(&all); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	byID := make(map[uuid.UUID]Reply, len(all))
+	for _, r := range all {
+		byID[r.ID] = r
+	}
+	var moved Replies
+	for _, rid := range rids {
+		r, ok := byID[rid]
+		if !ok || r.Deleted || r.Event != "" {
+			verrs.Add("replies", fmt.Sprintf("The reply %s can not be split from this topic.", rid))
+			continue
+		}
+		moved = append(moved, r)
+	}
+	if len(moved) == 0 {
+		verrs.Add("replies", "Select the replies to split into a new topic.")
+	}
+	if verrs.HasAny() {
+		return nil, verrs, nil
+	}
+	sort.Sort(moved)
+
+	first := moved[0]
+	topic := &Topic{
+		ID:         first.ID,
+		Title:      title,
+		Content:    first.Content,
+		AuthorID:   first.AuthorID,
+		CategoryID: cat,
+		EditedAt:   first.EditedAt,
+		Tags:       src.Tags,
+	}
+	for _, r := range moved {
+		topic.AddSubscriber(r.AuthorID)
+	}
+	verrs, err := tx.ValidateAndCreate(topic)
+	if err != nil || verrs.HasAny() {
+		return nil, verrs, errors.WithStack(err)
+	}
+	if err := setDates(tx, "topics", topic.ID, first.CreatedAt, first.UpdatedAt); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	topic.CreatedAt, topic.UpdatedAt = first.CreatedAt, first.UpdatedAt
+	if err := tx.Destroy(&first); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	for _, r := range moved {
+		for _, q := range []string{
+			"UPDATE replies SET topic_id = ? WHERE id = ?",
+			"UPDATE reactions SET topic_id = ? WHERE post_id = ?",
+			"UPDATE attachments SET topic_id = ? WHERE post_id = ?",
+		} {
+			if err := tx.RawQuery(q, topic.ID, r.ID).Exec(); err != nil {
+				return nil, nil, errors.WithStack(err)
+			}
+		}
+		if src.IsSolution(r.ID) {
+			src.SolutionID = nulls.UUID{}
+		}
+	}
+	// replies answering a post left behind, in either topic, now answer
+	// their topic.
+	for _, tid := range []uuid.UUID{src.ID, topic.ID} {
+		err := tx.RawQuery("UPDATE replies SET parent_reply_id = NULL WHERE topic_id = ? AND parent_reply_id IS NOT NULL AND parent_reply_id NOT IN (SELECT id FROM replies WHERE topic_id = ?)", tid, tid).Exec()
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+	}
+	if err := tx.Update(src); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if err := countReactions(tx, src.ID, topic.ID); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if err := splitReads(tx, src.ID, topic.ID); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if err := addEvent(tx, src.ID, uid, EventSplit, nulls.NewUUID(topic.ID)); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if err := addEvent(tx, topic.ID, uid, EventSplitFrom, nulls.NewUUID(src.ID)); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return topic, verrs, nil
+}
+
+// postTimes returns the creation times of the posts of a topic, its
+// opening post included. Events and deleted replies are left out.
+func postTimes(tx *pop.Connection, t *Topic) ([]time.Time, error) {
+	replies := Replies{}
+	if err := tx.Where("topic_id = ? AND deleted = ? AND event = ?", t.ID, false, "").All(&replies); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	times := make([]time.Time, 0, len(replies)+1)
+	times = append(times, t.CreatedAt)
+	for _, r := range replies {
+		times = append(times, r.CreatedAt)
+	}
+	return times, nil
+}
+
+// setDates sets the creation and update times of a row, which pop always
+// sets to the current time on creation.
+func setDates(tx *pop.Connection, table string, id uuid.UUID, created, updated time.Time) error {
+	err := tx.RawQuery("UPDATE "+table+" SET created_at = ?, updated_at = ? WHERE id = ?", created, updated, id).Exec()
+	return errors.WithStack(err)
+}
+
+// countReactions recounts the reactions to the posts of topics.
+func countReactions(tx *pop.Connection, topics ...uuid.UUID) error {
+	for _, tid := range topics {
+		err := tx.RawQuery("UPDATE topics SET reactions = (SELECT COUNT(*) FROM reactions WHERE topic_id = ?) WHERE id = ?", tid, tid).Exec()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"sort"
+
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_MoveTopic() {
+	mod := uuid.Must(uuid.NewV4())
+	src, dst := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	topic := &models.Topic{Title: "topic", Content: "content", CategoryID: src}
+	ms.NoError(ms.DB.Create(topic))
+
+	ms.NoError(models.MoveTopic(ms.DB, topic, dst, mod))
+	ms.NoError(ms.DB.Reload(topic))
+	ms.Equal(dst, topic.CategoryID)
+
+	replies := models.Replies{}
+	ms.NoError(ms.DB.Where("topic_id = ?", topic.ID).All(&replies))
+	ms.Len(replies, 1)
+	ms.Equal(models.EventMoved, replies[0].Event)
+	ms.Equal(src, replies[0].EventTarget.UUID)
+}
+
+func (ms *ModelSuite) Test_MergeTopic() {
+	mod, author := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	cat := uuid.Must(uuid.NewV4())
+	dst := &models.Topic{Title: "dst", Content: "first", CategoryID: cat}
+	ms.NoError(ms.DB.Create(dst))
+	src := &models.Topic{Title: "src", Content: "second", CategoryID: cat, AuthorID: author}
+	src.AddSubscriber(author)
+	ms.NoError(ms.DB.Create(src))
+	reply := &models.Reply{TopicID: src.ID, Content: "third"}
+	ms.NoError(ms.DB.Create(reply))
+
+	ms.NoError(models.MergeTopic(ms.DB, src, dst, mod))
+	ms.Error(models.MergeTopic(ms.DB, dst, dst, mod))
+	// src can not be merged again.
+	ms.NoError(ms.DB.Reload(src))
+	ms.Error(models.MergeTopic(ms.DB, src, dst, mod))
+
+	ms.True(src.Deleted)
+	ms.Equal(dst.ID, src.MergedInto.UUID)
+	ms.NoError(ms.DB.Reload(dst))
+	ms.True(dst.Subscribed(author))
+
+	replies := models.Replies{}
+	ms.NoError(ms.DB.Where("topic_id = ?", dst.ID).All(&replies))
+	ms.Len(replies, 3)
+	sort.Sort(replies)
+	posts := replies.Posts()
+	ms.Len(posts, 2)
+	ms.Equal(src.ID, posts[0].ID)
+	ms.Equal("second", posts[0].Content)
+	ms.Equal(src.ID, posts[1].ParentReplyID.UUID)
+}
+
+func (ms *ModelSuite) Test_SplitTopic() {
+	mod, author := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	cat := uuid.Must(uuid.NewV4())
+	src := &models.Topic{Title: "src", Content: "first", CategoryID: cat}
+	ms.NoError(ms.DB.Create(src))
+	kept := &models.Reply{TopicID: src.ID, Content: "kept"}
+	ms.NoError(ms.DB.Create(kept))
+	split := &models.Reply{TopicID: src.ID, Content: "split", AuthorID: author}
+	ms.NoError(ms.DB.Create(split))
+	answer := &models.Reply{TopicID: src.ID, Content: "answer", ParentReplyID: nulls.NewUUID(kept.ID)}
+	ms.NoError(ms.DB.Create(answer))
+
+	_, verrs, err := models.SplitTopic(ms.DB, src, nil, "new", cat, mod)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+
+	topic, verrs, err := models.SplitTopic(ms.DB, src, []uuid.UUID{answer.ID, split.ID}, "new", cat, mod)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.Equal(split.ID, topic.ID)
+	ms.Equal("split", topic.Content)
+	ms.True(topic.Subscribed(author))
+
+	replies := models.Replies{}
+	ms.NoError(ms.DB.Where("topic_id = ?", topic.ID).All(&replies))
+	posts := replies.Posts()
+	ms.Len(posts, 1)
+	ms.Equal(answer.ID, posts[0].ID)
+	// its parent was left in the other topic.
+	ms.False(posts[0].ParentReplyID.Valid)
+
+	replies = models.Replies{}
+	ms.NoError(ms.DB.Where("topic_id = ?", src.ID).All(&replies))
+	posts = replies.Posts()
+	ms.Len(posts, 1)
+	ms.Equal(kept.ID, posts[0].ID)
+}
+
+func (ms *ModelSuite) Test_MergeTopic_Reads() {
+	mod, cat := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	dst := &models.Topic{Title: "dst", Content: "first", CategoryID: cat}
+	ms.NoError(ms.DB.Create(dst))
+	src := &models.Topic{Title: "src", Content: "second", CategoryID: cat}
+	ms.NoError(ms.DB.Create(src))
+	reply := &models.Reply{TopicID: src.ID, Content: "third"}
+	ms.NoError(ms.DB.Create(reply))
+	answer := &models.Reply{TopicID: dst.ID, Content: "fourth"}
+	ms.NoError(ms.DB.Create(answer))
+	// the database keeps times to the microsecond.
+	for _, v := range []interface{}{dst, src, reply, answer} {
+		ms.NoError(ms.DB.Reload(v))
+	}
+
+	// usr read all of dst, but only the opening post of src.
+	usr := &models.User{ID: uuid.Must(uuid.NewV4())}
+	ms.NoError(models.MarkTopicRead(ms.DB, usr.ID, dst.ID, answer.CreatedAt))
+	ms.NoError(models.MarkTopicRead(ms.DB, usr.ID, src.ID, src.CreatedAt))
+	ms.NoError(models.MergeTopic(ms.DB, src, dst, mod))
+
+	ms.NoError(ms.DB.Where("topic_id = ?", dst.ID).Order("created_at").All(&dst.Replies))
+	reads, err := models.LoadReadState(ms.DB, usr, models.Topics{*dst})
+	ms.NoError(err)
+	ms.Equal(reply.ID, reads.FirstUnread(*dst))
+	ms.Equal(2, reads.Unread(*dst))
+}
+
+func (ms *ModelSuite) Test_SplitTopic_Reads() {
+	mod, cat := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	src := &models.Topic{Title: "src", Content: "first", CategoryID: cat}
+	ms.NoError(ms.DB.Create(src))
+	read := &models.Reply{TopicID: src.ID, Content: "read"}
+	ms.NoError(ms.DB.Create(read))
+	unread := &models.Reply{TopicID: src.ID, Content: "unread"}
+	ms.NoError(ms.DB.Create(unread))
+	ms.NoError(ms.DB.Reload(read))
+
+	usr := &models.User{ID: uuid.Must(uuid.NewV4())}
+	ms.NoError(models.MarkTopicRead(ms.DB, usr.ID, src.ID, read.CreatedAt))
+	topic, verrs, err := models.SplitTopic(ms.DB, src, []uuid.UUID{read.ID, unread.ID}, "new", cat, mod)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	// the posts read in src are read in the new topic.
+	ms.NoError(ms.DB.Where("topic_id = ?", topic.ID).Order("created_at").All(&topic.Replies))
+	reads, err := models.LoadReadState(ms.DB, usr, models.Topics{*topic})
+	ms.NoError(err)
+	ms.False(reads.IsNew(*topic))
+	ms.Equal(unread.ID, reads.FirstUnread(*topic))
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"sort"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Pin scopes of a topic.
+const (
+	PinNone     = ""         // the topic is not pinned
+	PinCategory = "category" // the topic comes first in its category
+	PinGlobal   = "global"   // the topic comes first in every category
+)
+
+// Topic state changes, recorded as event posts in the thread of the topic.
+const (
+	EventPinned         = "pinned"
+	EventPinnedGlobally = "pinned-globally"
+	EventUnpinned       = "unpinned"
+	EventLocked         = "locked"
+	EventUnlocked       = "unlocked"
+	EventClosed         = "closed"
+	EventOpened         = "opened"
+	EventUnlisted       = "unlisted"
+	EventListed         = "listed"
+)
+
+// SetState applies the state change event to the topic.
+// It reports whether the state of the topic changed.
+func (t *Topic) SetState(event string) (bool, error) {
+	var changed bool
+	switch event {
+	case EventPinned, EventPinnedGlobally, EventUnpinned:
+		pin := PinNone
+		switch event {
+		case EventPinned:
+			pin = PinCategory
+		case EventPinnedGlobally:
+			pin = PinGlobal
+		}
+		changed = t.Pinned != pin
+		t.Pinned = pin
+	case EventLocked, EventUnlocked:
+		changed = t.Locked != (event == EventLocked)
+		t.Locked = event == EventLocked
+	case EventClosed, EventOpened:
+		changed = t.Closed != (event == EventClosed)
+		t.Closed = event == EventClosed
+	case EventUnlisted, EventListed:
+		changed = t.Unlisted != (event == EventUnlisted)
+		t.Unlisted = event == EventUnlisted
+	default:
+		return false, errors.Errorf("invalid topic state change %q", event)
+	}
+	return changed, nil
+}
+
+// AcceptsReplies reports whether new replies may be posted to the topic.
+func (t Topic) AcceptsReplies() bool {
+	return !t.Locked && !t.Closed
+}
+
+// AddEvent records a state change of a topic, made by the user uid, as an
+// event post in its thread.
+func AddEvent(tx *pop.Connection, topic, uid uuid.UUID, event string) error {
+	return addEvent(tx, topic, uid, event, nulls.UUID{})
+}
+
+// addEvent records an event post referring to the category or topic
+// target, if valid.
+func addEvent(tx *pop.Connection, topic, uid uuid.UUID, event string, target nulls.UUID) error {
+	reply := &Reply{
+		TopicID:     topic,
+		AuthorID:    uid,
+		Event:       event,
+		EventTarget: target,
+	}
+	return errors.WithStack(tx.Create(reply))
+}
+
+// Posts returns the replies that are not event posts.
+func (p Replies) Posts() Replies {
+	var posts Replies
+	for _, r := range p {
+		if r.Event == "" {
+			posts = append(posts, r)
+		}
+	}
+	return posts
+}
+
+// PinnedFirst moves the pinned topics first, globally pinned ones leading,
+// keeping the relative order of the topics otherwise.
+func (p Topics) PinnedFirst() {
+	rank := func(t Topic) int {
+		switch t.Pinned {
+		case PinGlobal:
+			return 0
+		case PinCategory:
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(p, func(i, j int) bool { return rank(p[i]) < rank(p[j]) })
+}
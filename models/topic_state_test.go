@@ -0,0 +1,83 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/slices"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_Topic_SetState() {
+	topic := &models.Topic{}
+	ms.True(topic.AcceptsReplies())
+
+	changed, err := topic.SetState(models.EventPinnedGlobally)
+	ms.NoError(err)
+	ms.True(changed)
+	ms.Equal(models.PinGlobal, topic.Pinned)
+
+	changed, err = topic.SetState(models.EventPinned)
+	ms.NoError(err)
+	ms.True(changed)
+	ms.Equal(models.PinCategory, topic.Pinned)
+
+	changed, err = topic.SetState(models.EventClosed)
+	ms.NoError(err)
+	ms.True(changed)
+	ms.False(topic.AcceptsReplies())
+
+	changed, err = topic.SetState(models.EventClosed)
+	ms.NoError(err)
+	ms.False(changed)
+
+	changed, err = topic.SetState(models.EventUnlisted)
+	ms.NoError(err)
+	ms.True(changed)
+	ms.True(topic.Unlisted)
+
+	_, err = topic.SetState("deleted")
+	ms.Error(err)
+}
+
+func (ms *ModelSuite) Test_Topics_PinnedFirst() {
+	topics := models.Topics{
+		{Title: "a"},
+		{Title: "b", Pinned: models.PinCategory},
+		{Title: "c"},
+		{Title: "d", Pinned: models.PinGlobal},
+	}
+	topics.PinnedFirst()
+	var titles []string
+	for _, t := range topics {
+		titles = append(titles, t.Title)
+	}
+	ms.Equal([]string{"d", "b", "a", "c"}, titles)
+}
+
+func (ms *ModelSuite) Test_AddEvent() {
+	topic := uuid.Must(uuid.NewV4())
+	ms.NoError(models.AddEvent(ms.DB, topic, uuid.Must(uuid.NewV4()), models.EventLocked))
+	ms.NoError(ms.DB.Create(&models.Reply{TopicID: topic, Content: "reply"}))
+
+	replies := models.Replies{}
+	ms.NoError(ms.DB.Where("topic_id = ?", topic).All(&replies))
+	ms.Len(replies, 2)
+	posts := replies.Posts()
+	ms.Len(posts, 1)
+	ms.Equal("reply", posts[0].Content)
+}
+
+func (ms *ModelSuite) Test_User_CanEditIn() {
+	author := models.User{ID: uuid.Must(uuid.NewV4())}
+	mod := models.User{ID: uuid.Must(uuid.NewV4())}
+	cat := &models.Category{Moderators: slices.UUID{mod.ID}}
+	topic := &models.Topic{}
+	ms.True(author.CanEditIn(author.ID, topic, cat))
+
+	topic.Locked = true
+	ms.False(author.CanEditIn(author.ID, topic, cat))
+	ms.True(mod.CanEditIn(author.ID, topic, cat))
+}
@@ -5,25 +5,37 @@
 package models
 
 import (
+	"sort"
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/pop/slices"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
 )
 
 type Topic struct {
-	ID          uuid.UUID   `json:"id" db:"id"`
-	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at" db:"updated_at"`
-	Title       string      `json:"title" db:"title"`
-	Content     string      `json:"content" db:"content"`
-	AuthorID    uuid.UUID   `json:"author_id" db:"author_id"`
-	CategoryID  uuid.UUID   `json:"category_id" db:"category_id"`
-	Deleted     bool        `json:"deleted" db:"deleted"`
-	Subscribers slices.UUID `json:"subscribers" db:"subscribers"`
+	ID          uuid.UUID     `json:"id" db:"id"`
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" db:"updated_at"`
+	Title       string        `json:"title" db:"title"`
+	Content     string        `json:"content" db:"content"`
+	AuthorID    uuid.UUID     `json:"author_id" db:"author_id"`
+	CategoryID  uuid.UUID     `json:"category_id" db:"category_id"`
+	Deleted     bool          `json:"deleted" db:"deleted"`
+	Locked      bool          `json:"locked" db:"locked"`
+	Closed      bool          `json:"closed" db:"closed"`
+	Pinned      string        `json:"pinned" db:"pinned"` // one of PinNone, PinCategory or PinGlobal
+	Unlisted    bool          `json:"unlisted" db:"unlisted"`
+	EditedAt    nulls.Time    `json:"edited_at" db:"edited_at"`
+	Reactions   int           `json:"reactions" db:"reactions"`     // number of reactions to the topic and its replies
+	SolutionID  nulls.UUID    `json:"solution_id" db:"solution_id"` // the reply accepted as the solution, if any
+	Tags        slices.String `json:"tags" db:"tags"`
+	Subscribers slices.UUID   `json:"subscribers" db:"subscribers"`
+	MergedInto  nulls.UUID    `json:"merged_into" db:"merged_into"` // the topic this topic was merged into, if any
 
 	Author   *User     `json:"-" db:"-"`
 	Category *Category `json:"-" db:"-"`
@@ -43,7 +55,7 @@ func (p *Topic) Validate(tx *pop.Connection) (*validate.Errors, error) {
 func (t Topic) Authors() Users {
 	var set = make(map[uuid.UUID]User, 1+len(t.Replies))
 	set[t.Author.ID] = *t.Author
-	for _, reply := range t.Replies {
+	for _, reply := range t.Replies.Posts() {
 		_, dup := set[reply.AuthorID]
 		if dup {
 			continue
@@ -76,6 +88,18 @@ func (t Topic) LastUpdate() time.Time {
 	return v
 }
 
+// LastPost returns the creation time of the last post of a topic, events
+// included.
+func (t Topic) LastPost() time.Time {
+	last := t.CreatedAt
+	for _, r := range t.Replies {
+		if r.CreatedAt.After(last) {
+			last = r.CreatedAt
+		}
+	}
+	return last
+}
+
 func (t Topic) Subscribed(id uuid.UUID) bool {
 	for _, usr := range t.Subscribers {
 		if usr == id {
@@ -111,3 +135,47 @@ func (t *Topic) RemoveSubscriber(id uuid.UUID) {
 	}
 	t.Subscribers = subs
 }
+
+// SortByReactions sorts the topics by decreasing number of reactions.
+func (p Topics) SortByReactions() {
+	sort.SliceStable(p, func(i, j int) bool { return p[i].Reactions > p[j].Reactions })
+}
+
+// Solved reports whether a reply was accepted as the solution of the topic.
+func (t Topic) Solved() bool { return t.SolutionID.Valid }
+
+// IsSolution reports whether the reply rid is the accepted solution of
+// the topic.
+func (t Topic) IsSolution(rid uuid.UUID) bool {
+	return t.SolutionID.Valid && t.SolutionID.UUID == rid
+}
+
+// Solution returns the reply accepted as the solution of the topic, or nil.
+func (t Topic) Solution() *Reply {
+	if !t.SolutionID.Valid {
+		return nil
+	}
+	for i := range t.Replies {
+		if t.Replies[i].ID == t.SolutionID.UUID && !t.Replies[i].Deleted {
+			return &t.Replies[i]
+		}
+	}
+	return nil
+}
+
+// Unsolved returns the topics that have no accepted solution.
+func (p Topics) Unsolved() Topics {
+	var topics Topics
+	for _, t := range p {
+		if !t.Solved() {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// ClearSolution unmarks the reply rid wherever it is the accepted solution.
+func ClearSolution(tx *pop.Connection, rid uuid.UUID) error {
+	err := tx.RawQuery("UPDATE topics SET solution_id = NULL WHERE solution_id = ?", rid).Exec()
+	return errors.WithStack(err)
+}
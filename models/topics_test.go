@@ -0,0 +1,43 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_Topic_Solution() {
+	answer := models.Reply{ID: uuid.Must(uuid.NewV4())}
+	other := models.Reply{ID: uuid.Must(uuid.NewV4())}
+	topic := models.Topic{Replies: models.Replies{other, answer}}
+	ms.False(topic.Solved())
+	ms.Nil(topic.Solution())
+
+	topic.SolutionID = nulls.NewUUID(answer.ID)
+	ms.True(topic.Solved())
+	ms.True(topic.IsSolution(answer.ID))
+	ms.False(topic.IsSolution(other.ID))
+	ms.Equal(answer.ID, topic.Solution().ID)
+
+	topics := models.Topics{topic, {}}
+	ms.Len(topics.Unsolved(), 1)
+}
+
+func (ms *ModelSuite) Test_ClearSolution() {
+	rid := uuid.Must(uuid.NewV4())
+	topic := &models.Topic{
+		Title:      "title",
+		Content:    "content",
+		AuthorID:   uuid.Must(uuid.NewV4()),
+		CategoryID: uuid.Must(uuid.NewV4()),
+		SolutionID: nulls.NewUUID(rid),
+	}
+	ms.NoError(ms.DB.Create(topic))
+	ms.NoError(models.ClearSolution(ms.DB, rid))
+	ms.NoError(ms.DB.Find(topic, topic.ID))
+	ms.False(topic.Solved())
+}
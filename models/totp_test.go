@@ -0,0 +1,43 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"encoding/base32"
+	"time"
+
+	"github.com/go-saloon/saloon/models"
+)
+
+func (ms *ModelSuite) Test_TOTPCode() {
+	// test vectors from RFC 6238, truncated to 6 digits.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	for _, tc := range []struct {
+		t    int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		code, err := models.TOTPCode(secret, time.Unix(tc.t, 0))
+		ms.NoError(err)
+		ms.Equal(tc.want, code)
+	}
+}
+
+func (ms *ModelSuite) Test_User_CheckTOTP() {
+	secret, err := models.NewTOTPSecret()
+	ms.NoError(err)
+	u := &models.User{TOTPSecret: secret}
+
+	code, err := models.TOTPCode(secret, time.Now())
+	ms.NoError(err)
+	ms.False(u.CheckTOTP("000000x"))
+	ms.True(u.CheckTOTP(code))
+	ms.False(u.CheckTOTP(code), "code must not be replayed")
+}
@@ -23,18 +23,30 @@ import (
 )
 
 type User struct {
-	ID              uuid.UUID   `json:"id" db:"id"`
-	CreatedAt       time.Time   `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time   `json:"updated_at" db:"updated_at"`
-	Username        string      `json:"username" db:"username"`
-	Email           string      `json:"email" db:"email"`
-	PasswordHash    string      `json:"-" db:"password_hash"`
-	Password        string      `json:"-" db:"-"`
-	PasswordConfirm string      `json:"-" db:"-"`
-	FullName        string      `json:"full_name" db:"full_name" form:"full_name"`
-	Avatar          []byte      `json:"avatar" db:"avatar"`
-	Admin           bool        `json:"admin" db:"admin"`
-	Subscriptions   slices.UUID `json:"subscriptions" db:"subscriptions"`
+	ID               uuid.UUID     `json:"id" db:"id"`
+	CreatedAt        time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at" db:"updated_at"`
+	Username         string        `json:"username" db:"username"`
+	Email            string        `json:"email" db:"email"`
+	PasswordHash     string        `json:"-" db:"password_hash"`
+	Password         string        `json:"-" db:"-"`
+	PasswordConfirm  string        `json:"-" db:"-"`
+	FullName         string        `json:"full_name" db:"full_name" form:"full_name"`
+	Avatar           []byte        `json:"avatar" db:"avatar"`
+	EmailVerified    bool          `json:"email_verified" db:"email_verified" form:"-"`
+	Subscriptions    slices.UUID   `json:"subscriptions" db:"subscriptions"`
+	TagSubscriptions slices.String `json:"tag_subscriptions" db:"tag_subscriptions"`
+	Roles            slices.UUID   `json:"roles" db:"roles" form:"-"`
+
+	// Permissions granted by the roles of the user, see LoadPermissions.
+	Permissions []string `json:"-" db:"-"`
+
+	// TOTPSecret is the base32 secret of the user's authenticator.
+	// It is only used for logging in once TOTPEnabled is set.
+	// The TOTP fields are never bound from forms.
+	TOTPSecret   string `json:"-" db:"totp_secret" form:"-"`
+	TOTPEnabled  bool   `json:"totp_enabled" db:"totp_enabled" form:"-"`
+	TOTPLastStep int64  `json:"-" db:"totp_last_step" form:"-"`
 }
 
 // String is not required by pop and may be deleted
@@ -47,6 +59,86 @@ func (u User) IsAuthor(id uuid.UUID) bool {
 	return u.ID.String() == id.String()
 }
 
+// HasRole reports whether the user was assigned the given role.
+func (u User) HasRole(id uuid.UUID) bool {
+	for _, r := range u.Roles {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the user was granted the given permission.
+func (u User) Can(perm string) bool {
+	for _, p := range u.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Privileged reports whether the user was granted any permission.
+func (u User) Privileged() bool {
+	return len(u.Permissions) > 0
+}
+
+// Moderates reports whether the user may moderate the content of the
+// given category, either globally or as one of its moderators.
+func (u User) Moderates(cat *Category) bool {
+	return u.Can(PermModerate) || (cat != nil && cat.HasModerator(u.ID))
+}
+
+// CanEdit reports whether the user may edit a post written by author in
+// the given category.
+func (u User) CanEdit(author uuid.UUID, cat *Category) bool {
+	return u.ID == author || u.Can(PermEditAnyPost) || (cat != nil && cat.HasModerator(u.ID))
+}
+
+// CanEditIn reports whether the user may edit a post written by author in
+// the given topic and category. Only moderators may edit the posts of a
+// locked topic.
+func (u User) CanEditIn(author uuid.UUID, topic *Topic, cat *Category) bool {
+	if topic != nil && topic.Locked && !u.Moderates(cat) {
+		return false
+	}
+	return u.CanEdit(author, cat)
+}
+
+// CanDelete reports whether the user may delete a post written by author
+// in the given category.
+func (u User) CanDelete(author uuid.UUID, cat *Category) bool {
+	return u.ID == author || u.Moderates(cat)
+}
+
+// LoadPermissions collects the permissions granted by the roles of the user.
+func (u *User) LoadPermissions(tx *pop.Connection) error {
+	u.Permissions = nil
+	if len(u.Roles) == 0 {
+		return nil
+	}
+	roles := new(Roles)
+	if err := tx.All(roles); err != nil {
+		return errors.WithStack(err)
+	}
+	set := make(map[string]struct{})
+	for _, r := range *roles {
+		if !u.HasRole(r.ID) {
+			continue
+		}
+		for _, p := range r.Permissions {
+			set[p] = struct{}{}
+		}
+	}
+	for _, p := range Permissions {
+		if _, ok := set[p]; ok {
+			u.Permissions = append(u.Permissions, p)
+		}
+	}
+	return nil
+}
+
 func (u User) Subscribed(id uuid.UUID) bool {
 	for _, sub := range u.Subscriptions {
 		if sub == id {
@@ -103,7 +195,8 @@ func (p Users) Less(i, j int) bool { return p[i].Username < p[j].Username }
 // Create validates and creates a new User.
 func (u *User) Create(tx *pop.Connection) (*validate.Errors, error) {
 	u.Email = strings.ToLower(u.Email)
-	u.Admin = false
+	u.Roles = nil
+	u.EmailVerified = false
 	pwdHash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return validate.NewErrors(), errors.WithStack(err)
@@ -112,6 +205,27 @@ func (u *User) Create(tx *pop.Connection) (*validate.Errors, error) {
 	return tx.ValidateAndCreate(u)
 }
 
+// SetPassword updates the password hash of the user.
+func (u *User) SetPassword(pwd string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckTOTP verifies a code of the user's authenticator.
+// A valid code is recorded so that it can not be used twice.
+func (u *User) CheckTOTP(code string) bool {
+	step, ok := checkTOTP(u.TOTPSecret, code, time.Now(), u.TOTPLastStep)
+	if !ok {
+		return false
+	}
+	u.TOTPLastStep = step
+	return true
+}
+
 // Authorize checks user's password for logging in
 func (u *User) Authorize(tx *pop.Connection) error {
 	err := tx.Where("username = ?", u.Username).First(u)
@@ -0,0 +1,53 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// UserIdentity links a User to its account at an external identity provider.
+type UserIdentity struct {
+	ID        uuid.UUID    `json:"id" db:"id"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
+	UserID    uuid.UUID    `json:"user_id" db:"user_id"`
+	Provider  string       `json:"provider" db:"provider"`
+	Subject   string       `json:"subject" db:"subject"`
+	Email     nulls.String `json:"email" db:"email"`
+}
+
+type UserIdentities []UserIdentity
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (u *UserIdentity) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.UUIDIsPresent{Field: u.UserID, Name: "UserID"},
+		&validators.StringIsPresent{Field: u.Provider, Name: "Provider"},
+		&validators.StringIsPresent{Field: u.Subject, Name: "Subject"},
+	), nil
+}
+
+// FindUserIdentity returns the identity with the given subject at the given
+// provider, or nil if it is not linked to any user.
+func FindUserIdentity(tx *pop.Connection, provider, subject string) (*UserIdentity, error) {
+	id := new(UserIdentity)
+	err := tx.Where("provider = ? AND subject = ?", provider, subject).First(id)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	return id, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SessionMaxIdle is how long a session stays valid without being used.
+	SessionMaxIdle = 30 * 24 * time.Hour
+
+	// sessionTouchInterval limits how often the last-seen time of a
+	// session is recorded.
+	sessionTouchInterval = time.Minute
+)
+
+// UserSession is the server-side record of a logged in browser.
+// The session cookie only holds the ID of the record, so that deleting
+// the record revokes the session.
+type UserSession struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	IP         string    `json:"ip" db:"ip"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
+
+type UserSessions []UserSession
+
+func (p UserSessions) Len() int           { return len(p) }
+func (p UserSessions) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p UserSessions) Less(i, j int) bool { return p[i].LastSeenAt.After(p[j].LastSeenAt) }
+
+// NewUserSession records a new session for the user.
+func NewUserSession(tx *pop.Connection, usr *User, userAgent, ip string) (*UserSession, error) {
+	now := time.Now().UTC()
+	err := tx.RawQuery("DELETE FROM user_sessions WHERE last_seen_at < ?", now.Add(-SessionMaxIdle)).Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s := &UserSession{
+		UserID:     usr.ID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+	}
+	if err := tx.Create(s); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return s, nil
+}
+
+// FindUserSession retrieves a valid session of the given user.
+// It returns a nil session if the session was revoked or expired.
+func FindUserSession(tx *pop.Connection, id, uid uuid.UUID) (*UserSession, error) {
+	s := new(UserSession)
+	err := tx.Where("id = ? AND user_id = ?", id, uid).First(s)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	if time.Since(s.LastSeenAt) > SessionMaxIdle {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// Touch records that the session was used from the given address.
+func (s *UserSession) Touch(tx *pop.Connection, ip string) error {
+	now := time.Now().UTC()
+	if now.Sub(s.LastSeenAt) < sessionTouchInterval && ip == s.IP {
+		return nil
+	}
+	s.LastSeenAt = now
+	s.IP = ip
+	return errors.WithStack(tx.Update(s))
+}
+
+// RevokeUserSessions revokes all the sessions of a user, except keep.
+func RevokeUserSessions(tx *pop.Connection, uid, keep uuid.UUID) error {
+	err := tx.RawQuery("DELETE FROM user_sessions WHERE user_id = ? AND id != ?", uid, keep).Exec()
+	return errors.WithStack(err)
+}
+
+// Device returns a short description of the browser and operating system
+// of the session.
+func (s UserSession) Device() string {
+	find := func(names [][2]string) string {
+		for _, n := range names {
+			if strings.Contains(s.UserAgent, n[0]) {
+				return n[1]
+			}
+		}
+		return ""
+	}
+	// order matters: many user agents mention the browsers they derive from.
+	browser := find([][2]string{
+		{"Edge/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chromium/", "Chromium"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	})
+	os := find([][2]string{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "Chrome OS"},
+		{"Linux", "Linux"},
+	})
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	case s.UserAgent != "":
+		return s.UserAgent
+	}
+	return "Unknown device"
+}
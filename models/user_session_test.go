@@ -0,0 +1,61 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package models_test
+
+import (
+	"github.com/go-saloon/saloon/models"
+	"github.com/gobuffalo/uuid"
+)
+
+func (ms *ModelSuite) Test_UserSession() {
+	u := &models.User{
+		Username:        "usr1",
+		Email:           "user@example.com",
+		Password:        "password",
+		PasswordConfirm: "password",
+	}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	s1, err := models.NewUserSession(ms.DB, u, "Mozilla/5.0 (X11; Linux x86_64; rv:60.0) Gecko/20100101 Firefox/60.0", "192.0.2.1")
+	ms.NoError(err)
+	s2, err := models.NewUserSession(ms.DB, u, "curl/7.58.0", "192.0.2.2")
+	ms.NoError(err)
+	ms.Equal("Firefox on Linux", s1.Device())
+	ms.Equal("curl", s2.Device())
+
+	got, err := models.FindUserSession(ms.DB, s1.ID, u.ID)
+	ms.NoError(err)
+	ms.NotNil(got)
+
+	got, err = models.FindUserSession(ms.DB, s1.ID, uuid.Must(uuid.NewV4()))
+	ms.NoError(err)
+	ms.Nil(got, "sessions belong to their user")
+
+	ms.NoError(models.RevokeUserSessions(ms.DB, u.ID, s1.ID))
+	got, err = models.FindUserSession(ms.DB, s1.ID, u.ID)
+	ms.NoError(err)
+	ms.NotNil(got)
+	got, err = models.FindUserSession(ms.DB, s2.ID, u.ID)
+	ms.NoError(err)
+	ms.Nil(got, "revoked session")
+}
+
+func (ms *ModelSuite) Test_UserSession_Device() {
+	for _, tc := range []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/67.0.3396.99 Safari/537.36", "Chrome on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_13_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/11.1.1 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (Linux; Android 8.0.0; Pixel 2) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/67.0.3396.87 Mobile Safari/537.36", "Chrome on Android"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/64.0.3282.140 Safari/537.36 Edge/17.17134", "Edge on Windows"},
+		{"", "Unknown device"},
+	} {
+		s := models.UserSession{UserAgent: tc.ua}
+		ms.Equal(tc.want, s.Device(), tc.ua)
+	}
+}
@@ -23,7 +23,7 @@ func (ms *ModelSuite) Test_User_Create() {
 	ms.NoError(err)
 	ms.False(verrs.HasAny())
 	ms.NotZero(u.PasswordHash)
-	ms.False(u.Admin)
+	ms.Empty(u.Roles)
 
 	n, err = ms.DB.Count("users")
 	ms.NoError(err)
@@ -0,0 +1,87 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// local stores files in a directory of the local disk.
+type local struct {
+	dir string
+}
+
+// NewLocal returns a Storage keeping its files in dir.
+// The directory is created on first write.
+func NewLocal(dir string) Storage {
+	return &local{dir: dir}
+}
+
+func (s *local) path(key string) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+func (s *local) Put(ctx context.Context, key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return errors.Wrap(err, "storage: could not create directory")
+	}
+	// write to a temporary file first, so that readers never see a
+	// partial file.
+	f, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "storage: could not create file")
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "storage: could not write %q", key)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "storage: could not write %q", key)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return errors.Wrapf(err, "storage: could not write %q", key)
+	}
+	return nil
+}
+
+func (s *local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "storage: could not open %q", key)
+	}
+	return f, nil
+}
+
+func (s *local) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "storage: could not delete %q", key)
+	}
+	return nil
+}
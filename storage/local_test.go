@@ -0,0 +1,62 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saloon-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	s := NewLocal(dir)
+	if err := s.Put(ctx, "file.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.Open(ctx, "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("got %q, want %q", data, "hello")
+	}
+
+	if err := s.Delete(ctx, "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "file.txt"); err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+	if _, err := s.Open(ctx, "file.txt"); err != ErrNotExist {
+		t.Errorf("got %v, want ErrNotExist", err)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	for _, key := range []string{"a", "2f1c.thumb", "file_name-1.txt"} {
+		if err := CheckKey(key); err != nil {
+			t.Errorf("CheckKey(%q): %v", key, err)
+		}
+	}
+	for _, key := range []string{"", ".hidden", "../etc/passwd", "a/b", "a b"} {
+		if err := CheckKey(key); err == nil {
+			t.Errorf("CheckKey(%q) accepted an invalid key", key)
+		}
+	}
+}
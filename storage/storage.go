@@ -0,0 +1,41 @@
+// Copyright 2018 The go-saloon Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package storage defines where the files attached to topics and replies
+// are kept.
+package storage
+
+import (
+	"context"
+	"io"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotExist is returned when no file is stored under a key.
+var ErrNotExist = errors.New("storage: file does not exist")
+
+// Storage is a store of files, addressed by key.
+type Storage interface {
+	// Put stores the content of r under key, replacing any previous file.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns the content of the file stored under key.
+	// The caller must close it.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key.
+	// Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+var validKey = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// CheckKey checks a key is made of letters, digits, dots, dashes and
+// underscores only, so that every backend can store it as is.
+func CheckKey(key string) error {
+	if !validKey.MatchString(key) {
+		return errors.Errorf("storage: invalid key %q", key)
+	}
+	return nil
+}